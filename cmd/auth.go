@@ -2,12 +2,16 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"syscall"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 
 	"github.com/cploutarchou/swarmforge/pkg/auth"
+	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/traefik"
 )
 
 var authCmd = &cobra.Command{
@@ -36,16 +40,9 @@ Example:
 		}
 		fmt.Println()
 
-		fmt.Print("Enter master key for encryption: ")
-		masterBytes, err := term.ReadPassword(int(syscall.Stdin))
+		store, err := openCredentialStore("Enter master key for encryption: ")
 		if err != nil {
-			return fmt.Errorf("failed to read master key: %w", err)
-		}
-		fmt.Println()
-
-		store, err := auth.NewCredentialStore(string(masterBytes))
-		if err != nil {
-			return fmt.Errorf("failed to initialize credential store: %w", err)
+			return err
 		}
 		defer store.Close()
 
@@ -69,16 +66,9 @@ var listCredsCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List stored credentials",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Print("Enter master key for decryption: ")
-		masterBytes, err := term.ReadPassword(int(syscall.Stdin))
-		if err != nil {
-			return fmt.Errorf("failed to read master key: %w", err)
-		}
-		fmt.Println()
-
-		store, err := auth.NewCredentialStore(string(masterBytes))
+		store, err := openCredentialStore("Enter master key for decryption: ")
 		if err != nil {
-			return fmt.Errorf("failed to initialize credential store: %w", err)
+			return err
 		}
 		defer store.Close()
 
@@ -104,16 +94,9 @@ var deleteCredsCmd = &cobra.Command{
 			return fmt.Errorf("server and username are required")
 		}
 
-		fmt.Print("Enter master key for decryption: ")
-		masterBytes, err := term.ReadPassword(int(syscall.Stdin))
+		store, err := openCredentialStore("Enter master key for decryption: ")
 		if err != nil {
-			return fmt.Errorf("failed to read master key: %w", err)
-		}
-		fmt.Println()
-
-		store, err := auth.NewCredentialStore(string(masterBytes))
-		if err != nil {
-			return fmt.Errorf("failed to initialize credential store: %w", err)
+			return err
 		}
 		defer store.Close()
 
@@ -126,11 +109,156 @@ var deleteCredsCmd = &cobra.Command{
 	},
 }
 
+var (
+	publicKeysFile string
+	identityFile   string
+)
+
+var bootstrapKeysCmd = &cobra.Command{
+	Use:         "bootstrap-keys",
+	Short:       "Install SSH keys and disable password login",
+	Annotations: destructive,
+	Long: `Install team public keys on every stored server and disable password login.
+
+The stored password is used once per node to add the keys to authorized_keys.
+Password authentication is only turned off, through an sshd drop-in validated
+with sshd -t, after a key login with --identity has succeeded.
+
+Example:
+  infra auth bootstrap-keys --keys team.pub --identity ~/.ssh/id_ed25519`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if publicKeysFile == "" {
+			return fmt.Errorf("public keys file is required")
+		}
+
+		keys, err := auth.LoadPublicKeys(publicKeysFile)
+		if err != nil {
+			return err
+		}
+
+		store, err := openCredentialStore("Enter master key for decryption: ")
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		creds, err := store.ListCredentials()
+		if err != nil {
+			return fmt.Errorf("failed to list credentials: %w", err)
+		}
+
+		var failed []string
+		for _, cred := range creds {
+			if serverIP != "" && cred.Server != serverIP {
+				continue
+			}
+			if username != "" && cred.Username != username {
+				continue
+			}
+
+			fmt.Printf("Bootstrapping keys for %s@%s...\n", cred.Username, cred.Server)
+			if err := auth.BootstrapKeys(cred, keys, identityFile); err != nil {
+				fmt.Printf("  %v\n", err)
+				failed = append(failed, cred.Server)
+				continue
+			}
+			fmt.Println("  key login verified, password login disabled")
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("key bootstrap failed on: %v", failed)
+		}
+		return nil
+	},
+}
+
+// openCredentialStore prompts for the master key and opens the credential
+// store of the active configuration's namespace
+func openCredentialStore(prompt string) (*auth.CredentialStore, error) {
+	masterKey, err := readMasterKey(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := auth.NewNamespacedCredentialStore(masterKey, infraConfig.CredentialNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize credential store: %w", err)
+	}
+	return store, nil
+}
+
+// readMasterKey returns INFRA_MASTER_KEY when set, so that CI jobs can run
+// without a terminal, and prompts for the key otherwise
+func readMasterKey(prompt string) (string, error) {
+	if key := os.Getenv("INFRA_MASTER_KEY"); key != "" {
+		return key, nil
+	}
+
+	// The prompt goes to stderr so it never ends up in rendered output
+	fmt.Fprint(os.Stderr, prompt)
+	masterBytes, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return "", fmt.Errorf("failed to read master key: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+	return string(masterBytes), nil
+}
+
+// credentialLookup returns a template credential lookup and a lookup of
+// password hashes for basic auth that open the credential store on first
+// use, so templates that never call credential do not prompt for the master
+// key. The returned function closes the store.
+func credentialLookup() (template.CredentialLookup, traefik.HashLookup, func()) {
+	var store *auth.CredentialStore
+	open := func() error {
+		if store != nil {
+			return nil
+		}
+		var err error
+		store, err = openCredentialStore("Enter master key for decryption: ")
+		return err
+	}
+	lookup := func(server, user string) (string, error) {
+		if err := open(); err != nil {
+			return "", err
+		}
+		cred, err := store.GetCredentials(server, user)
+		if err != nil {
+			return "", err
+		}
+		if cred == nil {
+			return "", fmt.Errorf("no stored credentials for %s@%s", user, server)
+		}
+		return cred.Password, nil
+	}
+	hashLookup := func(server, user string) (string, error) {
+		if err := open(); err != nil {
+			return "", err
+		}
+		return store.PasswordHash(server, user)
+	}
+	closeStore := func() {
+		if store != nil {
+			store.Close()
+		}
+	}
+	return lookup, hashLookup, closeStore
+}
+
+func defaultIdentityFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "id_ed25519")
+}
+
 func init() {
 	// Add subcommands
 	authCmd.AddCommand(loginCmd)
 	authCmd.AddCommand(listCredsCmd)
 	authCmd.AddCommand(deleteCredsCmd)
+	authCmd.AddCommand(bootstrapKeysCmd)
 
 	// Add to root command
 	rootCmd.AddCommand(authCmd)
@@ -139,4 +267,7 @@ func init() {
 	authCmd.PersistentFlags().StringVar(&serverIP, "server", "", "Server IP address")
 	authCmd.PersistentFlags().StringVar(&username, "user", "", "Username")
 	authCmd.PersistentFlags().StringVar(&serverRole, "role", "", "Server role")
+	bootstrapKeysCmd.Flags().StringVar(&publicKeysFile, "keys", "", "File with team public keys in authorized_keys format")
+	bootstrapKeysCmd.Flags().StringVar(&identityFile, "identity", defaultIdentityFile(), "Private key used to verify key login")
+	bootstrapKeysCmd.MarkFlagRequired("keys")
 }
@@ -18,17 +18,43 @@ var (
 	backupPath string
 )
 
+// gitlabBackupDir is where gitlab-backup writes its archives on the host
+const gitlabBackupDir = "/var/opt/gitlab/backups"
+
+// backupDirectory returns the --path flag, falling back to backup.backup_dir
+// from the defaults
+func backupDirectory() string {
+	if backupPath != "" {
+		return backupPath
+	}
+	return infraDefaults.Backup.BackupDir
+}
+
 var createBackupCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new backup",
+	Use:         "create",
+	Short:       "Create a new backup",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
 		}
 
 		timestamp := time.Now().Format("20060102150405")
-		backupCmd := fmt.Sprintf("docker exec gitlab gitlab-backup create BACKUP=%s", timestamp)
-		
+		archive := fmt.Sprintf("%s_gitlab_backup.tar", timestamp)
+		backupDir := backupDirectory()
+
+		// Create the backup, copy it to the backup directory and apply the
+		// retention policy from the backup defaults
+		backupCmd := fmt.Sprintf("docker exec gitlab gitlab-backup create BACKUP=%s && mkdir -p %s && cp %s/%s %s/",
+			timestamp, backupDir, gitlabBackupDir, archive, backupDir)
+		if infraDefaults.Backup.Compression {
+			backupCmd += fmt.Sprintf(" && gzip -f %s/%s", backupDir, archive)
+		}
+		if infraDefaults.Backup.RetentionDays > 0 {
+			backupCmd += fmt.Sprintf(" && find %s -name '*_gitlab_backup.tar*' -mtime +%d -delete",
+				backupDir, infraDefaults.Backup.RetentionDays)
+		}
+
 		command := exec.Command("sshpass", "-p", password, "ssh",
 			"-o", "StrictHostKeyChecking=no",
 			fmt.Sprintf("%s@%s", username, serverIP),
@@ -45,17 +71,29 @@ var createBackupCmd = &cobra.Command{
 }
 
 var restoreBackupCmd = &cobra.Command{
-	Use:   "restore [timestamp]",
-	Short: "Restore from backup",
-	Args:  cobra.ExactArgs(1),
+	Use:         "restore [timestamp]",
+	Short:       "Restore from backup",
+	Annotations: destructive,
+	Args:        cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
 		}
 
 		timestamp := args[0]
-		restoreCmd := fmt.Sprintf("docker exec gitlab gitlab-backup restore BACKUP=%s", timestamp)
-		
+		archive := fmt.Sprintf("%s_gitlab_backup.tar", timestamp)
+		backupDir := backupDirectory()
+
+		// Bring the archive back from the backup directory if GitLab no
+		// longer has it
+		restoreCmd := fmt.Sprintf(`
+			if [ ! -f %[1]s/%[2]s ]; then
+				if [ -f %[3]s/%[2]s.gz ]; then zcat %[3]s/%[2]s.gz > %[1]s/%[2]s;
+				else cp %[3]s/%[2]s %[1]s/%[2]s; fi
+			fi &&
+			docker exec gitlab gitlab-backup restore BACKUP=%[4]s`,
+			gitlabBackupDir, archive, backupDir, timestamp)
+
 		command := exec.Command("sshpass", "-p", password, "ssh",
 			"-o", "StrictHostKeyChecking=no",
 			fmt.Sprintf("%s@%s", username, serverIP),
@@ -79,7 +117,7 @@ var listBackupsCmd = &cobra.Command{
 			return fmt.Errorf("server IP is required")
 		}
 
-		listCmd := "ls -l /var/opt/gitlab/backups/"
+		listCmd := fmt.Sprintf("ls -l %s/", backupDirectory())
 		command := exec.Command("sshpass", "-p", password, "ssh",
 			"-o", "StrictHostKeyChecking=no",
 			fmt.Sprintf("%s@%s", username, serverIP),
@@ -97,7 +135,7 @@ var listBackupsCmd = &cobra.Command{
 
 func init() {
 	// Add flags
-	backupCmd.PersistentFlags().StringVar(&backupPath, "path", "/var/opt/gitlab/backups", "Backup directory path")
+	backupCmd.PersistentFlags().StringVar(&backupPath, "path", "", "Backup directory path (defaults to backup.backup_dir)")
 
 	// Add subcommands
 	backupCmd.AddCommand(createBackupCmd)
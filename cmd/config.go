@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/config"
+)
+
+var checkCredentials bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+	Long:  `Commands for checking the configuration file and inventory.`,
+}
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Validate the configuration and inventory",
+	Long: `Check a configuration file for schema and semantic errors.
+
+Reports unknown keys, malformed addresses and domains, unknown roles, a
+missing or even number of managers and duplicate addresses, each with its file
+and line. With --check-credentials, node credential references are checked
+against the credential store; set INFRA_MASTER_KEY to run it in CI.
+
+Example:
+  infra config validate ./infra/config.yaml --check-credentials`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := configPath
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		var credentials []string
+		if checkCredentials {
+			store, err := openCredentialStore("Enter master key for decryption: ")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			creds, err := store.ListCredentials()
+			if err != nil {
+				return fmt.Errorf("failed to list credentials: %w", err)
+			}
+			credentials = make([]string, 0, len(creds))
+			for _, cred := range creds {
+				credentials = append(credentials, fmt.Sprintf("%s@%s", cred.Username, cred.Server))
+			}
+		}
+
+		issues, err := config.Validate(path, credentials)
+		if err != nil {
+			return err
+		}
+
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+		if len(issues) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d problem(s) found in %s", len(issues), path)
+		}
+
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(validateConfigCmd)
+	rootCmd.AddCommand(configCmd)
+
+	validateConfigCmd.Flags().BoolVar(&checkCredentials, "check-credentials", false, "Check node credential references against the credential store")
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/config"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+var (
+	contextFrom         string
+	credentialNamespace string
+)
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Manage cluster contexts",
+	Long: `Commands for managing named cluster contexts.
+
+A context is a configuration file under ~/.infra/contexts with its own
+inventory, domain, defaults and credential namespace. The current context is
+used by every command unless --context or --config is given.`,
+}
+
+var createContextCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a context",
+	Long: `Create a context, optionally seeded from an existing configuration file.
+
+Example:
+  infra context create staging --from ./staging.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if config.ContextExists(name) {
+			return fmt.Errorf("context %s already exists", name)
+		}
+
+		path, err := config.ContextPath(name)
+		if err != nil {
+			return err
+		}
+
+		cfg := &types.InfraConfig{}
+		if contextFrom != "" {
+			if cfg, err = config.Load(contextFrom); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("credential-namespace") || cfg.CredentialNamespace == "" {
+			cfg.CredentialNamespace = credentialNamespace
+		}
+		if cfg.CredentialNamespace == "" {
+			cfg.CredentialNamespace = name
+		}
+
+		if err := config.Save(path, cfg); err != nil {
+			return err
+		}
+
+		fmt.Printf("Context %s created at %s\n", name, path)
+		return nil
+	},
+}
+
+var useContextCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Switch the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.UseContext(args[0]); err != nil {
+			return err
+		}
+
+		fmt.Printf("Switched to context %s\n", args[0])
+		return nil
+	},
+}
+
+var listContextCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List contexts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, err := config.ListContexts()
+		if err != nil {
+			return err
+		}
+		// Mark the context set with context use, not a --context override
+		current, err := config.CurrentContext()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return nil
+	},
+}
+
+var currentContextCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show the current context",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if activeContext == "" {
+			return fmt.Errorf("no context is set, using %s", configPath)
+		}
+		fmt.Println(activeContext)
+		return nil
+	},
+}
+
+func init() {
+	contextCmd.AddCommand(createContextCmd, useContextCmd, listContextCmd, currentContextCmd)
+	rootCmd.AddCommand(contextCmd)
+
+	createContextCmd.Flags().StringVar(&contextFrom, "from", "", "Configuration file to copy into the context")
+	createContextCmd.Flags().StringVar(&credentialNamespace, "credential-namespace", "", "Credential namespace (defaults to the context name)")
+}
@@ -4,12 +4,55 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/cploutarchou/swarmforge/pkg/compose"
+	"github.com/cploutarchou/swarmforge/pkg/release"
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
 	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/traefik"
 	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// Traefik middleware flags of deploy service
+var (
+	middlewareNames []string
+	basicAuthUsers  []string
+	rateLimit       string
+	ipAllowList     []string
+	securityHeaders bool
+	compress        bool
+	retryAttempts   int
+	stripPrefixes   []string
+	redirectScheme  string
+)
+
+// defaultWaitTimeout is how long deployments get to become healthy by default
+const defaultWaitTimeout = 5 * time.Minute
+
+// stackNamePattern matches the stack names deployStackFile accepts, which
+// also name its directory on the manager
+var stackNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+const timeoutUsage = "How long to wait for the deployment to become healthy (0 skips waiting)"
+
+// waitTimeout is how long deployments get to become healthy
+var waitTimeout time.Duration
+
+// Traefik routing flags of deploy service
+var (
+	routeProtocol   string
+	routeEntrypoint string
+	routeTLS        string
 )
 
 var deployCmd = &cobra.Command{
@@ -20,8 +63,9 @@ Example: infra deploy --name api --type api --lang go --port 8080 --domain examp
 }
 
 var deployAllCmd = &cobra.Command{
-	Use:   "all",
-	Short: "Deploy entire infrastructure",
+	Use:         "all",
+	Short:       "Deploy entire infrastructure",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check swarm status
 		swarmCmd := exec.Command("./scripts/check-swarm.sh")
@@ -40,68 +84,525 @@ var deployAllCmd = &cobra.Command{
 }
 
 var deployServicesCmd = &cobra.Command{
-	Use:   "services",
-	Short: "Deploy all services",
+	Use:         "services",
+	Short:       "Deploy all services",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return deployServices()
 	},
 }
 
 var deployStackCmd = &cobra.Command{
-	Use:   "stack [name] [file]",
-	Short: "Deploy a stack from a compose file",
-	Args:  cobra.ExactArgs(2),
+	Use:         "stack [name] [file]",
+	Short:       "Deploy a stack from a compose file",
+	Annotations: destructive,
+	Args:        cobra.ExactArgs(2),
+	Long: `Deploy a stack from a compose file.
+
+The compose file is rendered as a template with the values files first, so
+replicas, resources, domains and environment variables can differ per
+environment, and the result is validated before it is uploaded. The env_file
+of each service and the file of each config and secret are uploaded with it;
+they must sit next to the compose file or below it.
+
+The stack is deployed with registry auth, and the command waits until every
+service runs its desired replicas. It fails with the errors of the failed
+tasks when the stack does not come up within --timeout.
+
+Example:
+  infra deploy stack shop shop.yaml --values values.yaml --env staging`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stackName := args[0]
 		composeFile := args[1]
-		// TODO: Implement stack deployment logic
-		fmt.Printf("Deploying stack %s from file %s\n", stackName, composeFile)
-		return nil
+		if serverIP == "" {
+			return fmt.Errorf("server IP is required")
+		}
+
+		config, err := loadDeploymentValues(valuesFile, valuesEnv)
+		if err != nil {
+			return err
+		}
+		completeUpdateConfig(&config)
+
+		generator := template.NewGenerator()
+		lookup, _, closeStore := credentialLookup()
+		defer closeStore()
+		generator.SetCredentialLookup(lookup)
+
+		if err := publishFileMounts(stackName, &config, lookup); err != nil {
+			return err
+		}
+
+		stackYAML, err := generator.RenderStackFile(composeFile, config)
+		if err != nil {
+			return err
+		}
+		if err := deployStackFile(stackName, composeFile, stackYAML); err != nil {
+			return err
+		}
+		return pruneFileMounts(stackName, config)
 	},
 }
 
+// deployStackFile uploads a rendered stack file together with the files it
+// refers to, deploys it and waits for it to converge
+func deployStackFile(stackName, composeFile, stackYAML string) error {
+	if !stackNamePattern.MatchString(stackName) {
+		return fmt.Errorf("invalid stack name %q", stackName)
+	}
+	files, err := compose.LocalFiles([]byte(stackYAML))
+	if err != nil {
+		return err
+	}
+
+	localFile := filepath.Join(os.TempDir(), stackName+".yaml")
+	if err := os.WriteFile(localFile, []byte(stackYAML), 0600); err != nil {
+		return fmt.Errorf("failed to write stack file: %w", err)
+	}
+	defer os.Remove(localFile)
+
+	// Relative paths in the stack file resolve against its directory, so
+	// the referenced files keep their place next to it
+	remoteDir := path.Join("/tmp/infra-stacks", stackName)
+	dirs := []string{utils.ShellQuote(remoteDir)}
+	for _, file := range files {
+		dirs = append(dirs, utils.ShellQuote(path.Join(remoteDir, path.Dir(file))))
+	}
+	if _, err := executeRemoteCommand(serverIP, username, password,
+		fmt.Sprintf("rm -rf %s && mkdir -p %s", utils.ShellQuote(remoteDir), strings.Join(dirs, " "))); err != nil {
+		return fmt.Errorf("failed to create stack directory: %w", err)
+	}
+	// docker stack deploy reads the files when it runs, so they are not
+	// needed afterwards
+	defer func() {
+		if _, err := executeRemoteCommand(serverIP, username, password, "rm -rf "+utils.ShellQuote(remoteDir)); err != nil {
+			fmt.Printf("Warning: failed to remove %s: %v\n", remoteDir, err)
+		}
+	}()
+
+	remoteFile := path.Join(remoteDir, "docker-compose.yaml")
+	if err := copyToServer(localFile, remoteFile); err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(composeFile)
+	for _, file := range files {
+		if err := copyToServer(filepath.Join(baseDir, filepath.FromSlash(file)), path.Join(remoteDir, file)); err != nil {
+			return err
+		}
+	}
+
+	since, err := deployStart()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deploying stack %s from file %s\n", stackName, composeFile)
+	result, err := executeRemoteCommand(serverIP, username, password,
+		fmt.Sprintf("cd %s && docker stack deploy --with-registry-auth -c docker-compose.yaml %s", utils.ShellQuote(remoteDir), stackName))
+	if err != nil {
+		return fmt.Errorf("failed to deploy stack: %w", err)
+	}
+	fmt.Println(result)
+
+	return waitForStack(stackName, since)
+}
+
+// deployStart returns the time on the manager before a deploy starts, for
+// waitForStack
+func deployStart() (time.Time, error) {
+	return swarm.Now(serverIP, username, password)
+}
+
+// waitForStack waits for the services of stack updated since since to run
+// their desired replicas and pass their healthchecks, unless --timeout is 0.
+// Only healthy deployments are recorded as releases.
+func waitForStack(stack string, since time.Time) error {
+	if waitTimeout <= 0 {
+		fmt.Printf("No release of stack %s recorded: --timeout 0 skips the health check releases need\n", stack)
+		return nil
+	}
+	fmt.Printf("Waiting up to %s for stack %s to become healthy\n", waitTimeout, stack)
+	if err := swarm.WaitForStack(serverIP, username, password, stack, since, waitTimeout); err != nil {
+		return err
+	}
+	fmt.Printf("Stack %s is healthy\n", stack)
+	return recordReleases(stack)
+}
+
+// recordReleases adds the image and environment of each service of stack to
+// its release history for deploy rollback
+func recordReleases(stack string) error {
+	states, err := swarm.ServiceStates(serverIP, username, password, "label=com.docker.stack.namespace="+stack)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		latest, added, err := release.Record(serverIP, username, password, state.Name)
+		if err != nil {
+			return err
+		}
+		if added {
+			fmt.Printf("Recorded release %d of %s\n", latest.Number, state.Name)
+		}
+	}
+	return nil
+}
+
+// serviceRoute returns the Traefik router labels of config. TCP and UDP
+// routes must use an entrypoint of the matching protocol when the
+// configuration declares entrypoints.
+func serviceRoute(config types.DeploymentConfig) (map[string]string, error) {
+	route := traefik.Route{
+		Service:    config.ServiceName,
+		Protocol:   config.Protocol,
+		Port:       config.Port,
+		Entrypoint: config.Entrypoint,
+		TLS:        config.TLS,
+	}
+	if config.Subdomain != "" && config.Domain != "" {
+		route.Host = config.Subdomain + "." + config.Domain
+	}
+
+	switch route.Protocol {
+	case "", traefik.HTTP:
+		if route.Host == "" {
+			return nil, fmt.Errorf("domain and subdomain are required when using Traefik")
+		}
+	case traefik.TCP, traefik.UDP:
+		if route.Entrypoint == "" {
+			return nil, fmt.Errorf("--entrypoint is required for %s routes", route.Protocol)
+		}
+		if route.Protocol == traefik.TCP && route.TLS == "" {
+			route.TLS = traefik.TLSTerminate
+		}
+		entrypoints := infraConfig.Traefik.Entrypoints
+		if ep, ok := entrypoints[route.Entrypoint]; ok {
+			if traefik.EntrypointProtocol(ep) != route.Protocol {
+				return nil, fmt.Errorf("entrypoint %s is %s, not %s", route.Entrypoint, traefik.EntrypointProtocol(ep), route.Protocol)
+			}
+		} else if len(entrypoints) > 0 {
+			return nil, fmt.Errorf("unknown entrypoint %s, known entrypoints are %v",
+				route.Entrypoint, traefik.EntrypointNames(infraConfig.Traefik))
+		}
+	}
+	return traefik.RouteLabels(route)
+}
+
+// inlineMiddlewares returns the configured middleware catalog extended with
+// the middlewares given as flags, and the names of those middlewares. Inline
+// middlewares are named after the service.
+func inlineMiddlewares(service string) (types.TraefikConfig, []string, error) {
+	catalog := types.TraefikConfig{
+		Middlewares: make(map[string]types.Middleware),
+		Chains:      infraConfig.Traefik.Chains,
+	}
+	for name, m := range infraConfig.Traefik.Middlewares {
+		catalog.Middlewares[name] = m
+	}
+
+	var inline []types.Middleware
+	if len(basicAuthUsers) > 0 {
+		inline = append(inline, types.Middleware{BasicAuth: basicAuthUsers})
+	}
+	if rateLimit != "" {
+		limit := &types.RateLimit{}
+		average, burst, _ := strings.Cut(rateLimit, "/")
+		var err error
+		if limit.Average, err = strconv.Atoi(average); err != nil {
+			return catalog, nil, fmt.Errorf("malformed rate limit %q, expected <average>[/<burst>]", rateLimit)
+		}
+		if burst != "" {
+			if limit.Burst, err = strconv.Atoi(burst); err != nil {
+				return catalog, nil, fmt.Errorf("malformed rate limit %q, expected <average>[/<burst>]", rateLimit)
+			}
+		}
+		inline = append(inline, types.Middleware{RateLimit: limit})
+	}
+	if len(ipAllowList) > 0 {
+		inline = append(inline, types.Middleware{IPAllowList: ipAllowList})
+	}
+	if securityHeaders {
+		inline = append(inline, types.Middleware{SecurityHeaders: true})
+	}
+	if compress {
+		inline = append(inline, types.Middleware{Compress: true})
+	}
+	if retryAttempts > 0 {
+		inline = append(inline, types.Middleware{Retry: retryAttempts})
+	}
+	if len(stripPrefixes) > 0 {
+		inline = append(inline, types.Middleware{StripPrefix: stripPrefixes})
+	}
+	if redirectScheme != "" {
+		inline = append(inline, types.Middleware{RedirectScheme: redirectScheme})
+	}
+
+	names := make([]string, 0, len(inline))
+	for _, m := range inline {
+		kind, err := traefik.Kind(m)
+		if err != nil {
+			return catalog, nil, err
+		}
+		name := service + "-" + kind
+		catalog.Middlewares[name] = m
+		names = append(names, name)
+	}
+	return catalog, names, nil
+}
+
+// withDefaultEnv appends KEY=value defaults whose key env does not set
+func withDefaultEnv(env []string, defaults ...string) []string {
+	set := make(map[string]bool, len(env))
+	for _, entry := range env {
+		set[strings.SplitN(entry, "=", 2)[0]] = true
+	}
+	for _, entry := range defaults {
+		if !set[strings.SplitN(entry, "=", 2)[0]] {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// resolveFileMounts reads the content of the configs and secrets of config
+// and sets their versioned object names, scoped to scope. It returns the
+// content by object name.
+func resolveFileMounts(scope string, config *types.DeploymentConfig, lookup template.CredentialLookup) (map[string][]byte, error) {
+	contents := make(map[string][]byte)
+	resolve := func(kind secrets.Kind, mounts []types.FileMount) error {
+		for i := range mounts {
+			mount := &mounts[i]
+			if mount.Name == "" || mount.Target == "" {
+				return fmt.Errorf("%s mounts need a name and a target", kind)
+			}
+
+			var data []byte
+			switch {
+			case mount.File != "" && mount.Credential != "":
+				return fmt.Errorf("%s %s sets both file and credential", kind, mount.Name)
+			case mount.File != "":
+				content, err := os.ReadFile(mount.File)
+				if err != nil {
+					return fmt.Errorf("failed to read %s %s: %w", kind, mount.Name, err)
+				}
+				data = content
+			case mount.Credential != "" && kind == secrets.Secret:
+				server, user, ok := strings.Cut(mount.Credential, "/")
+				if !ok || server == "" || user == "" {
+					return fmt.Errorf("malformed credential %q of secret %s, expected server/username", mount.Credential, mount.Name)
+				}
+				value, err := lookup(server, user)
+				if err != nil {
+					return err
+				}
+				data = []byte(value)
+			default:
+				return fmt.Errorf("%s %s needs a file", kind, mount.Name)
+			}
+
+			mount.Object = secrets.VersionedName(scope+"_"+mount.Name, data)
+			contents[mount.Object] = data
+		}
+		return nil
+	}
+
+	if err := resolve(secrets.Config, config.Configs); err != nil {
+		return nil, err
+	}
+	if err := resolve(secrets.Secret, config.Secrets); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// publishFileMounts creates the configs and secrets of config on the
+// manager. Changed content gets a new object name, so redeploying the stack
+// rolls the service onto it.
+func publishFileMounts(scope string, config *types.DeploymentConfig, lookup template.CredentialLookup) error {
+	contents, err := resolveFileMounts(scope, config, lookup)
+	if err != nil {
+		return err
+	}
+
+	publish := func(kind secrets.Kind, mounts []types.FileMount) error {
+		for _, mount := range mounts {
+			item := secrets.Item{Name: scope + "_" + mount.Name, Data: contents[mount.Object]}
+			name, created, err := secrets.Publish(serverIP, username, password, kind, item)
+			if err != nil {
+				return err
+			}
+			if created {
+				fmt.Printf("Created %s %s\n", kind, name)
+			}
+		}
+		return nil
+	}
+
+	if err := publish(secrets.Config, config.Configs); err != nil {
+		return err
+	}
+	return publish(secrets.Secret, config.Secrets)
+}
+
+// pruneFileMounts removes older versions of the configs and secrets of
+// config once no service uses them
+func pruneFileMounts(scope string, config types.DeploymentConfig) error {
+	prune := func(kind secrets.Kind, mounts []types.FileMount) error {
+		if len(mounts) == 0 {
+			return nil
+		}
+		bases := make([]string, 0, len(mounts))
+		keep := make([]string, 0, len(mounts))
+		for _, mount := range mounts {
+			bases = append(bases, scope+"_"+mount.Name)
+			keep = append(keep, mount.Object)
+		}
+		pruned, err := secrets.Prune(serverIP, username, password, kind, bases, keep)
+		for _, name := range pruned {
+			fmt.Printf("Pruned %s %s\n", kind, name)
+		}
+		return err
+	}
+
+	if err := prune(secrets.Config, config.Configs); err != nil {
+		return err
+	}
+	return prune(secrets.Secret, config.Secrets)
+}
+
+// copyToServer copies a local file to path on the target server
+func copyToServer(localPath, remotePath string) error {
+	scpCmd := exec.Command("sshpass", "-p", password, "scp",
+		"-o", "StrictHostKeyChecking=no",
+		localPath,
+		fmt.Sprintf("%s@%s:%s", username, serverIP, remotePath))
+
+	if output, err := scpCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy %s: %w\n%s", filepath.Base(localPath), err, string(output))
+	}
+	return nil
+}
+
 var deployServiceCmd = &cobra.Command{
-	Use:   "service",
-	Short: "Deploy a service",
+	Use:         "service",
+	Short:       "Deploy a service",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
 		}
 
-		// Generate deployment configuration
-		config := types.DeploymentConfig{
-			ServiceName: serviceName,
-			ImageName:   fmt.Sprintf("%s-%s", serviceName, appType),
-			Port:        port,
-			Replicas:    replicas,
-			Domain:      domain,
-			Subdomain:   subdomain,
-			UseTraefik:  useTraefik,
-			Labels:      make(map[string]string),
-			Environment: map[string]string{
-				"SERVICE_NAME": serviceName,
-				"APP_PORT":     fmt.Sprintf("%d", port),
-			},
+		// Defaults, then values files, then explicitly set flags
+		config, err := loadDeploymentValues(valuesFile, valuesEnv)
+		if err != nil {
+			return err
+		}
+		flags := cmd.Flags()
+		if flags.Changed("name") {
+			config.ServiceName = serviceName
+		}
+		if flags.Changed("type") {
+			config.AppType = types.AppType(appType)
+		}
+		if flags.Changed("lang") {
+			config.Language = types.Language(appLang)
+		}
+		if flags.Changed("tag") {
+			config.Version = imageTag
+		}
+		if flags.Changed("port") {
+			config.Port = port
+		}
+		if flags.Changed("replicas") {
+			config.Replicas = replicas
+		}
+		if flags.Changed("domain") || config.Domain == "" {
+			config.Domain = domain
+		}
+		if flags.Changed("subdomain") {
+			config.Subdomain = subdomain
+		}
+		if flags.Changed("use-traefik") {
+			config.UseTraefik = useTraefik
+		}
+		if flags.Changed("protocol") {
+			config.Protocol = routeProtocol
+		}
+		if flags.Changed("entrypoint") {
+			config.Entrypoint = routeEntrypoint
+		}
+		if flags.Changed("tls") {
+			config.TLS = routeTLS
+		}
+
+		if config.ServiceName == "" {
+			return fmt.Errorf("service name is required")
+		}
+		if config.Language == "" {
+			return fmt.Errorf("application language is required")
+		}
+		if err := completeDeployment(&config); err != nil {
+			return err
+		}
+
+		if len(config.Placement) == 0 || flags.Changed("node-role") {
+			placementRole, ok := types.GetRoleDefinition(types.ServerRole(nodeRole))
+			if !ok {
+				return fmt.Errorf("invalid node role. Valid roles are: %v", types.ValidServerRoles())
+			}
+			config.Placement = placementRole.Placement
+		}
+		config.Environment = withDefaultEnv(config.Environment,
+			"SERVICE_NAME="+config.ServiceName,
+			fmt.Sprintf("APP_PORT=%d", config.Port))
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
 		}
 
 		// Add Traefik labels if enabled
-		if useTraefik {
-			if domain == "" || subdomain == "" {
-				return fmt.Errorf("domain and subdomain are required when using Traefik")
+		name := config.ServiceName
+		if config.UseTraefik {
+			routeLabels, err := serviceRoute(config)
+			if err != nil {
+				return err
+			}
+			for key, value := range routeLabels {
+				config.Labels[key] = value
 			}
+		}
 
-			config.Labels = map[string]string{
-				"traefik.enable": "true",
-				"traefik.http.routers." + serviceName + ".rule":                      fmt.Sprintf("Host(`%s.%s`)", subdomain, domain),
-				"traefik.http.routers." + serviceName + ".service":                   serviceName,
-				"traefik.http.services." + serviceName + ".loadbalancer.server.port": fmt.Sprintf("%d", port),
-				"traefik.http.routers." + serviceName + ".entrypoints":               "websecure",
-				"traefik.http.routers." + serviceName + ".tls.certresolver":          "letsencrypt",
+		lookup, hashLookup, closeStore := credentialLookup()
+		defer closeStore()
+
+		// Attach middlewares from the catalog and the inline flags
+		catalog, inline, err := inlineMiddlewares(name)
+		if err != nil {
+			return err
+		}
+		config.Middlewares = append(append(config.Middlewares, middlewareNames...), inline...)
+		if len(config.Middlewares) > 0 {
+			if !config.UseTraefik {
+				return fmt.Errorf("middlewares need Traefik routing, use --use-traefik")
+			}
+			if config.Protocol != "" && config.Protocol != traefik.HTTP {
+				return fmt.Errorf("middlewares are only supported on HTTP routes")
+			}
+			mwLabels, err := traefik.Router(name, config.Middlewares, catalog, hashLookup)
+			if err != nil {
+				return err
 			}
+			for key, value := range mwLabels {
+				config.Labels[key] = value
+			}
+		}
+
+		// Publish configs and secrets under content-versioned names
+		if err := publishFileMounts(name, &config, lookup); err != nil {
+			return err
 		}
 
 		// Generate deployment files
 		generator := template.NewGenerator()
+		generator.SetCredentialLookup(lookup)
 
 		// Generate main deployment
 		deploymentYAML, err := generator.GenerateDeployment(config)
@@ -109,55 +610,68 @@ var deployServiceCmd = &cobra.Command{
 			return fmt.Errorf("failed to generate deployment: %w", err)
 		}
 
-		// Generate Traefik config if enabled
-		var traefikYAML string
-		if useTraefik {
-			traefikYAML, err = generator.GenerateTraefikConfig(config)
-			if err != nil {
-				return fmt.Errorf("failed to generate Traefik config: %w", err)
-			}
-		}
-
 		// Save deployment files
-		deployDir := filepath.Join("/tmp", serviceName)
-		if err := os.MkdirAll(deployDir, 0755); err != nil {
+		if !stackNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid service name %q", name)
+		}
+		deployDir, err := os.MkdirTemp("", "infra-deploy-")
+		if err != nil {
 			return fmt.Errorf("failed to create deployment directory: %w", err)
 		}
+		defer os.RemoveAll(deployDir)
 
 		deploymentFile := filepath.Join(deployDir, "deployment.yaml")
-		if err := os.WriteFile(deploymentFile, []byte(deploymentYAML), 0644); err != nil {
+		if err := os.WriteFile(deploymentFile, []byte(deploymentYAML), 0600); err != nil {
 			return fmt.Errorf("failed to write deployment file: %w", err)
 		}
 
-		if useTraefik {
-			traefikFile := filepath.Join(deployDir, "traefik.yaml")
-			if err := os.WriteFile(traefikFile, []byte(traefikYAML), 0644); err != nil {
-				return fmt.Errorf("failed to write Traefik config: %w", err)
-			}
-		}
-
 		// Copy files to server
-		scpCmd := fmt.Sprintf("scp -r %s %s@%s:/tmp/", deployDir, username, serverIP)
-		if err := exec.Command("sh", "-c", scpCmd).Run(); err != nil {
-			return fmt.Errorf("failed to copy deployment files: %w", err)
+		remoteDir := path.Join("/tmp/infra-stacks", name)
+		if _, err := executeRemoteCommand(serverIP, username, password,
+			fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s", utils.ShellQuote(remoteDir))); err != nil {
+			return fmt.Errorf("failed to create deployment directory: %w", err)
+		}
+		defer func() {
+			if _, err := executeRemoteCommand(serverIP, username, password, "rm -rf "+utils.ShellQuote(remoteDir)); err != nil {
+				fmt.Printf("Warning: failed to remove %s: %v\n", remoteDir, err)
+			}
+		}()
+		remoteFile := path.Join(remoteDir, "deployment.yaml")
+		if err := copyToServer(deploymentFile, remoteFile); err != nil {
+			return err
 		}
 
 		// Deploy the service
-		deployCmd := fmt.Sprintf("docker stack deploy -c /tmp/%s/deployment.yaml %s", serviceName, serviceName)
-		if useTraefik {
-			deployCmd += fmt.Sprintf(" && docker stack deploy -c /tmp/%s/traefik.yaml traefik", serviceName)
-		}
+		// Traefik routes through the service labels, so only the service
+		// stack is deployed
+		deployCmd := fmt.Sprintf("docker stack deploy -c %s %s", utils.ShellQuote(remoteFile), name)
 
+		since, err := deployStart()
+		if err != nil {
+			return err
+		}
 		result, err := executeRemoteCommand(serverIP, username, password, deployCmd)
 		if err != nil {
 			return fmt.Errorf("failed to deploy service: %w", err)
 		}
+		fmt.Println(result)
+		if err := waitForStack(name, since); err != nil {
+			return err
+		}
 
-		fmt.Printf("Service %s deployed successfully\n", serviceName)
-		if useTraefik {
-			fmt.Printf("Service available at: https://%s.%s\n", subdomain, domain)
+		if err := pruneFileMounts(name, config); err != nil {
+			return err
+		}
+
+		fmt.Printf("Service %s deployed successfully\n", name)
+		if config.UseTraefik {
+			switch config.Protocol {
+			case traefik.TCP, traefik.UDP:
+				fmt.Printf("Service available on entrypoint %s (%s)\n", config.Entrypoint, config.Protocol)
+			default:
+				fmt.Printf("Service available at: https://%s.%s\n", config.Subdomain, config.Domain)
+			}
 		}
-		fmt.Println(result)
 
 		return nil
 	},
@@ -187,6 +701,10 @@ func deployServices() error {
 		}
 
 		// Deploy stack
+		since, err := deployStart()
+		if err != nil {
+			return err
+		}
 		deployCmd := exec.Command("sshpass", "-p", password, "ssh",
 			"-o", "StrictHostKeyChecking=no",
 			fmt.Sprintf("%s@%s", username, serverIP),
@@ -195,6 +713,9 @@ func deployServices() error {
 		if output, err := deployCmd.CombinedOutput(); err != nil {
 			return fmt.Errorf("failed to deploy %s: %w\n%s", stack, err, string(output))
 		}
+		if err := waitForStack(stack[:len(stack)-5], since); err != nil {
+			return err
+		}
 	}
 
 	fmt.Println("Services deployed successfully")
@@ -232,15 +753,31 @@ func init() {
 
 	// Add flags
 	deployServiceCmd.Flags().StringVar(&serviceName, "name", "", "Service name")
-	deployServiceCmd.Flags().StringVar(&appType, "type", "", "Application type (api, standalone)")
+	deployServiceCmd.Flags().StringVar(&appType, "type", string(types.APIApp), "Application type (api, standalone)")
 	deployServiceCmd.Flags().StringVar(&appLang, "lang", "", "Application language")
-	deployServiceCmd.Flags().IntVar(&port, "port", 8080, "Service port")
-	deployServiceCmd.Flags().IntVar(&replicas, "replicas", 1, "Number of replicas")
+	deployServiceCmd.Flags().StringVar(&imageTag, "tag", "latest", "Image tag to deploy")
+	deployServiceCmd.Flags().IntVar(&port, "port", 0, "Service port (defaults to the language's port)")
+	deployServiceCmd.Flags().IntVar(&replicas, "replicas", 0, "Number of replicas (defaults to service.replicas)")
 	deployServiceCmd.Flags().StringVar(&domain, "domain", "", "Domain name for Traefik routing")
 	deployServiceCmd.Flags().StringVar(&subdomain, "subdomain", "", "Subdomain for Traefik routing")
 	deployServiceCmd.Flags().BoolVar(&useTraefik, "use-traefik", false, "Enable Traefik routing")
-
-	deployServiceCmd.MarkFlagRequired("name")
-	deployServiceCmd.MarkFlagRequired("type")
-	deployServiceCmd.MarkFlagRequired("lang")
+	deployServiceCmd.Flags().StringVar(&routeProtocol, "protocol", traefik.HTTP, "Traefik route protocol (http, tcp, udp)")
+	deployServiceCmd.Flags().StringVar(&routeEntrypoint, "entrypoint", "", "Traefik entrypoint of TCP and UDP routes")
+	deployServiceCmd.Flags().StringVar(&routeTLS, "tls", traefik.TLSTerminate, "TLS mode of TCP routes (terminate, passthrough, none)")
+	deployServiceCmd.Flags().StringSliceVar(&middlewareNames, "middleware", nil, "Traefik middleware or chain from the configuration (repeatable)")
+	deployServiceCmd.Flags().StringSliceVar(&basicAuthUsers, "basic-auth", nil, "Require basic auth for a stored credential, as server/username (repeatable)")
+	deployServiceCmd.Flags().StringVar(&rateLimit, "rate-limit", "", "Rate limit as <average>[/<burst>] requests per second")
+	deployServiceCmd.Flags().StringSliceVar(&ipAllowList, "ip-allow", nil, "Allowed source IP range (repeatable)")
+	deployServiceCmd.Flags().BoolVar(&securityHeaders, "security-headers", false, "Add HSTS and other security headers")
+	deployServiceCmd.Flags().BoolVar(&compress, "compress", false, "Compress responses")
+	deployServiceCmd.Flags().IntVar(&retryAttempts, "retry", 0, "Retry failed requests this many times")
+	deployServiceCmd.Flags().StringSliceVar(&stripPrefixes, "strip-prefix", nil, "Path prefix to strip before forwarding (repeatable)")
+	deployServiceCmd.Flags().StringVar(&redirectScheme, "redirect-scheme", "", "Redirect requests to this scheme, e.g. https")
+	deployServiceCmd.Flags().StringVar(&nodeRole, "node-role", string(types.AppsServer), "Role of the nodes the service is placed on")
+
+	deployCmd.PersistentFlags().DurationVar(&waitTimeout, "timeout", defaultWaitTimeout, timeoutUsage)
+	for _, c := range []*cobra.Command{deployServiceCmd, deployStackCmd} {
+		c.Flags().StringVar(&valuesFile, "values", "", "Base values file")
+		c.Flags().StringVar(&valuesEnv, "env", "", "Environment whose values overlay (values.<env>.yaml) is merged over --values")
+	}
 }
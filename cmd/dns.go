@@ -16,16 +16,18 @@ var dnsCmd = &cobra.Command{
 }
 
 var updateDNSCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update DNS records",
+	Use:         "update",
+	Short:       "Update DNS records",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return dns.UpdateDNSRecord(domain, subdomain, serverIP)
 	},
 }
 
 var deleteDNSCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete DNS records",
+	Use:         "delete",
+	Short:       "Delete DNS records",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return dns.DeleteDNSRecord(domain, subdomain)
 	},
@@ -47,16 +49,27 @@ var verifyDNSCmd = &cobra.Command{
 			return fmt.Errorf("domain is required")
 		}
 
-		// Verify DNS records
-		verifyCmd := fmt.Sprintf("dig +short %s", domain)
-		command := exec.Command("bash", "-c", verifyCmd)
-
-		output, err := command.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to verify DNS: %w\n%s", err, string(output))
+		nameservers := infraDefaults.DNS.Nameservers
+		if len(nameservers) == 0 {
+			nameservers = []string{""}
 		}
 
-		fmt.Printf("DNS records for %s:\n%s", domain, string(output))
+		// Verify DNS records against each configured nameserver
+		for _, ns := range nameservers {
+			args := []string{"+short", domain}
+			label := "default resolver"
+			if ns != "" {
+				args = append([]string{"@" + ns}, args...)
+				label = ns
+			}
+
+			output, err := exec.Command("dig", args...).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("failed to verify DNS via %s: %w\n%s", label, err, string(output))
+			}
+
+			fmt.Printf("DNS records for %s (%s):\n%s", domain, label, string(output))
+		}
 		return nil
 	},
 }
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/config"
+	"github.com/cploutarchou/swarmforge/pkg/inventory"
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+var (
+	nodeAddress  string
+	nodeLabels   []string
+	nodeGroups   []string
+	nodeJump     string
+	importOutput string
+	exportOutput string
+	exportFormat string
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Manage the node inventory",
+	Long: `Commands for managing the inventory of nodes in the configuration file.
+
+Each node has a name, an address, a role, labels and any number of groups.
+Commands that take --ip also accept a node name or a group; every node is
+implicitly a member of the group named after its role.`,
+}
+
+var listInventoryCmd = &cobra.Command{
+	Use:   "list [group]",
+	Short: "List inventory nodes",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodes := infraConfig.Inventory()
+		if len(args) == 1 {
+			nodes = infraConfig.ResolveTarget(args[0])
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tADDRESS\tROLE\tGROUPS\tLABELS")
+		for _, node := range nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", node.Name, node.Address, node.Role,
+				strings.Join(node.Groups, ","), formatLabels(node.Labels))
+		}
+		return w.Flush()
+	},
+}
+
+var addInventoryCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add or replace a node",
+	Long: `Add a node to the inventory, replacing any node with the same name.
+
+Example:
+  infra inventory add app-1 --address 10.0.0.21 --role apps --group eu-west --label zone=a`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if nodeAddress == "" {
+			return fmt.Errorf("node address is required")
+		}
+		if serverRole == "" {
+			return fmt.Errorf("node role is required, set it with --role")
+		}
+		if !types.IsValidServerRole(serverRole) {
+			return fmt.Errorf("invalid server role. Valid roles are: %v", types.ValidServerRoles())
+		}
+
+		labels, err := parseLabels(nodeLabels)
+		if err != nil {
+			return err
+		}
+
+		node := types.NodeConfig{
+			Name:    args[0],
+			Address: nodeAddress,
+			Role:    types.ServerRole(serverRole),
+			Labels:  labels,
+			Groups:  nodeGroups,
+			Jump:    nodeJump,
+		}
+		if cmd.Flags().Changed("user") {
+			node.User = username
+		}
+
+		infraConfig.AddNode(node)
+		if err := config.Save(configPath, infraConfig); err != nil {
+			return err
+		}
+
+		fmt.Printf("Node %s (%s) saved to %s\n", node.Name, node.Address, configPath)
+		return nil
+	},
+}
+
+var removeInventoryCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a node",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !infraConfig.RemoveNode(args[0]) {
+			return fmt.Errorf("node %s not found in inventory", args[0])
+		}
+		if err := config.Save(configPath, infraConfig); err != nil {
+			return err
+		}
+
+		fmt.Printf("Node %s removed from %s\n", args[0], configPath)
+		return nil
+	},
+}
+
+var showInventoryCmd = &cobra.Command{
+	Use:   "show [name|group]",
+	Short: "Show node details",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodes := infraConfig.ResolveTarget(args[0])
+		if len(nodes) == 0 {
+			return fmt.Errorf("no node or group named %s", args[0])
+		}
+
+		out, err := config.Marshal(nodes)
+		if err != nil {
+			return fmt.Errorf("failed to encode nodes: %w", err)
+		}
+		fmt.Print(string(out))
+		return nil
+	},
+}
+
+var importInventoryCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the inventory from a live swarm",
+	Long: `Read the nodes of an existing swarm and write them as an inventory file.
+
+The role label of each node is mapped back to a server role. Nodes without a
+role label and labels that disagree with the role are marked with REVIEW
+comments in the written file.
+
+Example:
+  infra inventory import --ip 192.168.1.10 --output ./inventory.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serverIP == "" {
+			return fmt.Errorf("server IP is required")
+		}
+		if _, err := os.Stat(importOutput); err == nil && !force {
+			return fmt.Errorf("%s already exists, use --force to overwrite", importOutput)
+		}
+
+		address, err := infraConfig.ResolveAddress(serverIP)
+		if err != nil {
+			return err
+		}
+
+		nodes, err := swarm.InspectNodes(address, username, password)
+		if err != nil {
+			return err
+		}
+
+		imported := inventory.FromSwarm(nodes)
+		if err := inventory.Write(importOutput, imported); err != nil {
+			return err
+		}
+
+		var flagged int
+		for _, item := range imported {
+			if len(item.Review) == 0 {
+				continue
+			}
+			flagged++
+			for _, note := range item.Review {
+				fmt.Printf("REVIEW %s: %s\n", item.Node.Name, note)
+			}
+		}
+		fmt.Printf("Imported %d nodes to %s (%d flagged for review)\n", len(imported), importOutput, flagged)
+		return nil
+	},
+}
+
+var exportInventoryCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the inventory for other tools",
+	Long: `Export the inventory as an Ansible YAML inventory, an ~/.ssh/config snippet
+or JSON, so other tools share the same host list.
+
+Example:
+  infra inventory export --format ansible --output hosts.yaml
+  infra inventory export --format ssh-config >> ~/.ssh/config`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := inventory.Export(infraConfig, exportFormat)
+		if err != nil {
+			return err
+		}
+
+		if exportOutput == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(exportOutput, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", exportOutput, err)
+		}
+		fmt.Printf("Inventory exported to %s\n", exportOutput)
+		return nil
+	},
+}
+
+// parseLabels converts key=value pairs to a label map
+func parseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func init() {
+	inventoryCmd.AddCommand(listInventoryCmd, addInventoryCmd, removeInventoryCmd, showInventoryCmd, importInventoryCmd, exportInventoryCmd)
+	rootCmd.AddCommand(inventoryCmd)
+
+	addInventoryCmd.Flags().StringVar(&nodeAddress, "address", "", "Node IP address or hostname")
+	addInventoryCmd.Flags().StringArrayVar(&nodeLabels, "label", nil, "Node label as key=value (repeatable)")
+	addInventoryCmd.Flags().StringArrayVar(&nodeGroups, "group", nil, "Group the node belongs to (repeatable)")
+	addInventoryCmd.Flags().StringVar(&nodeJump, "jump", "", "Node name or host used as SSH jump host")
+	addInventoryCmd.MarkFlagRequired("address")
+
+	importInventoryCmd.Flags().StringVar(&importOutput, "output", "inventory.yaml", "Inventory file to write")
+	importInventoryCmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing inventory file")
+
+	exportInventoryCmd.Flags().StringVar(&exportFormat, "format", inventory.FormatAnsible, "Export format (ansible, ssh-config, json)")
+	exportInventoryCmd.Flags().StringVar(&exportOutput, "output", "", "File to write instead of stdout")
+}
@@ -17,11 +17,15 @@ var migrateCmd = &cobra.Command{
 }
 
 var migrateNodeCmd = &cobra.Command{
-	Use:   "node [server-ip]",
-	Short: "Migrate a node to a new role",
-	Args:  cobra.ExactArgs(1),
+	Use:         "node [server-ip]",
+	Short:       "Migrate a node to a new role",
+	Annotations: destructive,
+	Args:        cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		serverIP := args[0]
+		serverIP, err := infraConfig.ResolveAddress(args[0])
+		if err != nil {
+			return err
+		}
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
 		}
@@ -42,13 +46,14 @@ var migrateNodeCmd = &cobra.Command{
 		role := types.ServerRole(serverRole)
 
 		// Validate role
-		switch role {
-		case types.ManagerServer, types.GitlabServer, types.MonitorServer, types.AppsServer:
-			// Valid role
-		default:
+		if !types.IsValidServerRole(serverRole) {
 			return fmt.Errorf("invalid server role: %s", serverRole)
 		}
 
+		if managerIP == "" {
+			return fmt.Errorf("manager IP is required")
+		}
+
 		if !force {
 			fmt.Printf("WARNING: This will migrate node %s to role %s. Continue? [y/N] ", serverIP, role)
 			var response string
@@ -59,13 +64,14 @@ var migrateNodeCmd = &cobra.Command{
 		}
 
 		fmt.Printf("Migrating node %s to role %s...\n", serverIP, role)
-		return migration.MigrateNode(serverIP, username, password, role)
+		return migration.MigrateNode(managerIP, managerUser, managerPassword, serverIP, username, password, role)
 	},
 }
 
 var setupManagerCmd = &cobra.Command{
-	Use:   "setup-manager",
-	Short: "Set up a new manager node",
+	Use:         "setup-manager",
+	Short:       "Set up a new manager node",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if !force {
 			fmt.Printf("WARNING: This will set up %s as a new manager node. Continue? [y/N] ", targetIP)
@@ -103,12 +109,19 @@ var setupManagerCmd = &cobra.Command{
 }
 
 var migrateTraefikCmd = &cobra.Command{
-	Use:   "traefik [source-ip] [target-ip]",
-	Short: "Migrate Traefik from one node to another",
-	Args:  cobra.ExactArgs(2),
+	Use:         "traefik [source-ip] [target-ip]",
+	Short:       "Migrate Traefik from one node to another",
+	Annotations: destructive,
+	Args:        cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		sourceIP := args[0]
-		targetIP := args[1]
+		sourceIP, err := infraConfig.ResolveAddress(args[0])
+		if err != nil {
+			return err
+		}
+		targetIP, err := infraConfig.ResolveAddress(args[1])
+		if err != nil {
+			return err
+		}
 
 		if username == "" {
 			return fmt.Errorf("username is required")
@@ -130,7 +143,8 @@ func init() {
 	migrateCmd.AddCommand(migrateTraefikCmd)
 
 	// Add flags for migrate node command
-	migrateNodeCmd.Flags().StringVar(&serverRole, "role", "", "New role for the server (manager, gitlab, monitor, apps)")
+	migrateNodeCmd.Flags().StringVar(&serverRole, "role", "", "New role for the server (manager, gitlab, monitor, apps or a custom role)")
+	migrateNodeCmd.Flags().StringVar(&managerIP, "manager-ip", "", "Manager node IP address")
 	migrateNodeCmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompt")
 	migrateNodeCmd.MarkFlagRequired("role")
 
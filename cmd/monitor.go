@@ -85,8 +85,9 @@ var checkServicesCmd = &cobra.Command{
 }
 
 var setupMonitoringCmd = &cobra.Command{
-	Use:   "setup",
-	Short: "Setup monitoring stack",
+	Use:         "setup",
+	Short:       "Setup monitoring stack",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
@@ -104,6 +105,10 @@ var setupMonitoringCmd = &cobra.Command{
 		}
 
 		// Deploy monitoring stack
+		since, err := deployStart()
+		if err != nil {
+			return err
+		}
 		deployCmd := exec.Command("sshpass", "-p", password, "ssh",
 			"-o", "StrictHostKeyChecking=no",
 			fmt.Sprintf("%s@%s", username, serverIP),
@@ -112,6 +117,9 @@ var setupMonitoringCmd = &cobra.Command{
 		if output, err := deployCmd.CombinedOutput(); err != nil {
 			return fmt.Errorf("failed to deploy monitoring stack: %w\n%s", err, string(output))
 		}
+		if err := waitForStack("monitoring", since); err != nil {
+			return err
+		}
 
 		fmt.Println("Monitoring stack deployed successfully")
 		return nil
@@ -126,4 +134,7 @@ func init() {
 
 	// Add to root command
 	rootCmd.AddCommand(monitorCmd)
+
+	// Add flags
+	setupMonitoringCmd.Flags().DurationVar(&waitTimeout, "timeout", defaultWaitTimeout, timeoutUsage)
 }
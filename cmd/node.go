@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/auth"
+	"github.com/cploutarchou/swarmforge/pkg/cloudinit"
+	"github.com/cploutarchou/swarmforge/pkg/config"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+var (
+	adminUser     string
+	dockerVersion string
+	joinSwarm     bool
+	tokenTTL      time.Duration
+	rotateToken   bool
+	nodeHostname  string
+	cloudInitOut  string
+)
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Provision new nodes",
+	Long:  `Commands for preparing new nodes before they join the swarm.`,
+}
+
+var cloudInitCmd = &cobra.Command{
+	Use:   "cloud-init",
+	Short: "Generate cloud-init user-data for a new node",
+	Long: `Generate cloud-init user-data that brings a new VM up ready for its role.
+
+The user-data creates the admin user with the given public keys, installs the
+pinned Docker version and applies the role's packages, directories, setup
+steps and firewall rules. With --join the node, named --hostname, joins the
+swarm on first boot and the manager applies the role's labels once it has
+joined, so role placement constraints match it.
+
+The join token is shared by every node joining with the same role. With
+--token-ttl the manager rotates it once the TTL has passed, which also
+invalidates any other user-data or join still using it. Only one rotation
+per token is scheduled at a time: while one is pending, new user-data keeps
+its time, so the token may expire before --token-ttl. Generate the user-data
+of a batch of VMs together and boot them within the TTL. --rotate-token
+rotates the token right away, invalidating earlier user-data that has not
+booted yet, and schedules its rotation anew.
+
+Example:
+  infra node cloud-init --role apps --hostname app-3 --keys team.pub --join --token-ttl 1h --output user-data.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("role") {
+			return fmt.Errorf("role is required")
+		}
+		role := types.ServerRole(serverRole)
+		if !types.IsValidServerRole(serverRole) {
+			return fmt.Errorf("invalid server role. Valid roles are: %v", types.ValidServerRoles())
+		}
+
+		opts := cloudinit.Options{
+			Role:          role,
+			AdminUser:     adminUser,
+			DockerVersion: dockerVersion,
+			LogDriver:     infraDefaults.Docker.LogDriver,
+			LogOptions:    infraDefaults.Docker.LogOpts,
+		}
+		if opts.DockerVersion == "" {
+			opts.DockerVersion = infraDefaults.Docker.Version
+		}
+		if infraDefaults.Security.FirewallEnabled {
+			opts.FirewallRules = firewallRules(role)
+		}
+
+		if publicKeysFile != "" {
+			keys, err := auth.LoadPublicKeys(publicKeysFile)
+			if err != nil {
+				return err
+			}
+			opts.PublicKeys = keys
+		}
+
+		if joinSwarm {
+			if managerIP == "" {
+				return fmt.Errorf("manager IP is required to join the swarm")
+			}
+			if nodeHostname == "" {
+				return fmt.Errorf("hostname is required to label the node once it joins")
+			}
+			if !config.ValidHostname(nodeHostname) {
+				return fmt.Errorf("invalid hostname %q", nodeHostname)
+			}
+			token, err := joinToken(role, rotateToken, tokenTTL)
+			if err != nil {
+				return err
+			}
+			if err := labelOnJoin(nodeHostname, role, tokenTTL); err != nil {
+				return err
+			}
+			opts.Hostname = nodeHostname
+			opts.JoinToken = token
+			opts.ManagerAddr = managerIP
+			// The address of the new VM is unknown, so docker picks one unless
+			// an advertise address is configured
+			opts.AdvertiseAddr = swarmAdvertiseAddr("")
+		}
+
+		data, err := cloudinit.Render(opts)
+		if err != nil {
+			return err
+		}
+
+		if cloudInitOut == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(cloudInitOut, data, 0600); err != nil {
+			return fmt.Errorf("failed to write user-data: %w", err)
+		}
+		fmt.Printf("Wrote cloud-init user-data for a %s node to %s\n", role, cloudInitOut)
+		return nil
+	},
+}
+
+// joinToken returns the join token for the role, rotating it first when
+// rotate is set. With a TTL the token is rotated on the manager once it
+// expires. The rotation runs as one systemd unit per token kind, so a
+// rotation that is already scheduled is kept rather than stacked, unless the
+// token was just rotated and needs a full TTL.
+func joinToken(role types.ServerRole, rotate bool, ttl time.Duration) (string, error) {
+	kind := "worker"
+	if role == types.ManagerServer {
+		kind = "manager"
+	}
+
+	command := fmt.Sprintf("docker swarm join-token -q %s", kind)
+	if rotate {
+		command = fmt.Sprintf("docker swarm join-token --rotate -q %s", kind)
+	}
+	result, err := executeRemoteCommand(managerIP, managerUser, managerPassword, command)
+	if err != nil {
+		return "", fmt.Errorf("failed to get join token: %w", err)
+	}
+	token := strings.TrimSpace(result)
+
+	if ttl > 0 {
+		unit := "infra-rotate-" + kind + "-token"
+		run := fmt.Sprintf("systemctl reset-failed %[1]s.service >/dev/null 2>&1; systemd-run --quiet --unit %[1]s --on-active=%[2]ds docker swarm join-token --rotate -q %[3]s",
+			unit, int(ttl.Seconds()), kind)
+		schedule := fmt.Sprintf("if systemctl is-active --quiet %s.timer; then echo scheduled; else %s; fi", unit, run)
+		if rotate {
+			schedule = fmt.Sprintf("systemctl stop %s.timer >/dev/null 2>&1; %s", unit, run)
+		}
+		output, err := executeRemoteCommand(managerIP, managerUser, managerPassword, schedule)
+		if err != nil {
+			return "", fmt.Errorf("failed to schedule join token rotation: %w", err)
+		}
+		if strings.TrimSpace(output) == "scheduled" {
+			fmt.Fprintf(os.Stderr, "A rotation of the %s join token is already scheduled, so it may expire before --token-ttl; use --rotate-token for a full TTL\n", kind)
+		}
+	}
+	return token, nil
+}
+
+// labelOnJoin starts a job on the manager that applies the labels of role to
+// the node named hostname as soon as it joins. The job gives up after ttl,
+// or an hour without one, since the token no longer admits the node then.
+// A job left from earlier user-data for the same hostname is replaced.
+func labelOnJoin(hostname string, role types.ServerRole, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	args := []string{"docker node update"}
+	for key, value := range types.GetServerLabels(role) {
+		args = append(args, "--label-add "+utils.ShellQuote(key+"="+value))
+	}
+	update := strings.Join(append(args, utils.ShellQuote(hostname)), " ")
+
+	attempts := int(ttl / (15 * time.Second))
+	if attempts < 1 {
+		attempts = 1
+	}
+	script := fmt.Sprintf("for i in $(seq %d); do %s >/dev/null 2>&1 && exit 0; sleep 15; done; exit 1", attempts, update)
+	unit := "infra-label-" + hostname
+	command := fmt.Sprintf("systemctl stop %[1]s.service >/dev/null 2>&1; systemctl reset-failed %[1]s.service >/dev/null 2>&1; systemd-run --quiet --unit %[1]s sh -c %[2]s",
+		unit, utils.ShellQuote(script))
+	if _, err := executeRemoteCommand(managerIP, managerUser, managerPassword, command); err != nil {
+		return fmt.Errorf("failed to schedule labels for %s: %w", hostname, err)
+	}
+	return nil
+}
+
+func init() {
+	// Add subcommands
+	nodeCmd.AddCommand(cloudInitCmd)
+
+	// Add to root command
+	rootCmd.AddCommand(nodeCmd)
+
+	// Add flags
+	cloudInitCmd.Flags().StringVar(&adminUser, "admin-user", "infra", "Admin user to create")
+	cloudInitCmd.Flags().StringVar(&publicKeysFile, "keys", "", "File with the public keys of the admin user")
+	cloudInitCmd.Flags().StringVar(&dockerVersion, "docker-version", "", "Docker version to install (defaults to docker.version)")
+	cloudInitCmd.Flags().BoolVar(&joinSwarm, "join", false, "Join the swarm on first boot")
+	cloudInitCmd.Flags().StringVar(&managerIP, "manager-ip", "", "Manager node IP address")
+	cloudInitCmd.Flags().StringVar(&advertiseAddr, "advertise-addr", "", "Advertise address (format: <ip|interface>[:port])")
+	cloudInitCmd.Flags().StringVar(&nodeHostname, "hostname", "", "Hostname of the new node, required with --join")
+	cloudInitCmd.Flags().BoolVar(&rotateToken, "rotate-token", false, "Rotate the join token before embedding it, invalidating earlier user-data")
+	cloudInitCmd.Flags().DurationVar(&tokenTTL, "token-ttl", time.Hour, "Rotate the join token on the manager after this long (0 disables)")
+	cloudInitCmd.Flags().StringVarP(&cloudInitOut, "output", "o", "", "Write user-data to a file instead of stdout")
+}
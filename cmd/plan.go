@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cploutarchou/swarmforge/pkg/compose"
+	"github.com/cploutarchou/swarmforge/pkg/plan"
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/values"
+)
+
+var (
+	stateFile  string
+	pruneState bool
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show how the swarm differs from infra.yaml",
+	Long: `Compare the desired state in infra.yaml with the live swarm.
+
+The plan lists the networks, secrets, node labels, services and stacks that
+apply would add, change or remove, with the changed fields of each. Secrets
+are compared by content hash and stacks by the hash of the rendered stack
+file and the files it refers to.
+
+Example:
+  infra plan --ip 192.168.1.10 -f infra.yaml --prune`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, _, p, closeStore, err := buildPlan()
+		defer closeStore()
+		if err != nil {
+			return err
+		}
+		fmt.Print(p)
+		return nil
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:         "apply",
+	Short:       "Bring the swarm to the state in infra.yaml",
+	Annotations: destructive,
+	Long: `Compute the plan against the live swarm and carry it out.
+
+Networks and secrets are created first, then node labels, services and
+stacks. With --prune, networks, secrets, services and stacks created by an
+earlier apply but no longer in infra.yaml are removed, as are undeclared
+labels of the declared nodes and unused versions of the declared secrets.
+
+Example:
+  infra apply --ip 192.168.1.10 -f infra.yaml --prune`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		desired, stacks, p, closeStore, err := buildPlan()
+		defer closeStore()
+		if err != nil {
+			return err
+		}
+		fmt.Print(p)
+		if p.Empty() {
+			return nil
+		}
+
+		if !force {
+			fmt.Print("Apply this plan? [y/N] ")
+			var response string
+			fmt.Scanln(&response)
+			if strings.ToLower(response) != "y" {
+				return fmt.Errorf("apply aborted")
+			}
+		}
+
+		applier := &plan.Applier{
+			IP:          serverIP,
+			Username:    username,
+			Password:    password,
+			DeployStack: stacks.deploy,
+			Timeout:     waitTimeout,
+			Log: func(format string, args ...interface{}) {
+				fmt.Printf(format+"\n", args...)
+			},
+		}
+		if err := applier.Apply(p, desired, pruneState); err != nil {
+			return err
+		}
+		fmt.Println("Apply complete")
+		return nil
+	},
+}
+
+// desiredStacks holds the rendered stacks of infra.yaml for deployment
+type desiredStacks struct {
+	files   map[string]string
+	configs map[string]types.DeploymentConfig
+	yaml    map[string]string
+	lookup  template.CredentialLookup
+}
+
+func (s *desiredStacks) deploy(name string) error {
+	config := s.configs[name]
+	if err := publishFileMounts(name, &config, s.lookup); err != nil {
+		return err
+	}
+	if err := deployStackFile(name, s.files[name], s.yaml[name]); err != nil {
+		return err
+	}
+	return pruneFileMounts(name, config)
+}
+
+// buildPlan loads infra.yaml, resolves it and diffs it against the swarm.
+// The returned function closes the credential store.
+func buildPlan() (plan.Desired, *desiredStacks, plan.Plan, func(), error) {
+	lookup, _, closeStore := credentialLookup()
+	if serverIP == "" {
+		return plan.Desired{}, nil, plan.Plan{}, closeStore, fmt.Errorf("server IP is required")
+	}
+
+	state, err := loadDesiredState(stateFile)
+	if err != nil {
+		return plan.Desired{}, nil, plan.Plan{}, closeStore, err
+	}
+	desired, stacks, err := resolveDesiredState(state, filepath.Dir(stateFile), lookup)
+	if err != nil {
+		return desired, nil, plan.Plan{}, closeStore, err
+	}
+
+	live, err := plan.ReadLive(serverIP, username, password)
+	if err != nil {
+		return desired, nil, plan.Plan{}, closeStore, err
+	}
+	p, err := plan.Diff(desired, live, pruneState)
+	return desired, stacks, p, closeStore, err
+}
+
+// loadDesiredState reads infra.yaml, rejecting unknown keys and services
+// that use undeclared secrets
+func loadDesiredState(path string) (types.DesiredState, error) {
+	var state types.DesiredState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, fmt.Errorf("failed to read desired state: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&state); err != nil {
+		return state, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for name, service := range state.Services {
+		if service.Image == "" {
+			return state, fmt.Errorf("service %s has no image", name)
+		}
+		switch service.Mode {
+		case "", plan.Replicated:
+		case plan.Global:
+			if service.Replicas != 0 {
+				return state, fmt.Errorf("service %s is global and cannot set replicas", name)
+			}
+		default:
+			return state, fmt.Errorf("service %s has invalid mode %q, expected replicated or global", name, service.Mode)
+		}
+		for _, secret := range service.Secrets {
+			if _, ok := state.Secrets[secret]; !ok {
+				return state, fmt.Errorf("service %s uses undeclared secret %s", name, secret)
+			}
+		}
+	}
+	for name, stack := range state.Stacks {
+		if stack.File == "" {
+			return state, fmt.Errorf("stack %s has no file", name)
+		}
+	}
+	return state, nil
+}
+
+// resolveDesiredState reads the content of the secrets and renders the
+// stacks of state. Relative paths are relative to dir, the directory of
+// infra.yaml.
+func resolveDesiredState(state types.DesiredState, dir string, lookup template.CredentialLookup) (plan.Desired, *desiredStacks, error) {
+	desired := plan.Desired{
+		State:       state,
+		SecretData:  make(map[string][]byte),
+		StackHashes: make(map[string]string),
+	}
+	stacks := &desiredStacks{
+		files:   make(map[string]string),
+		configs: make(map[string]types.DeploymentConfig),
+		yaml:    make(map[string]string),
+		lookup:  lookup,
+	}
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	for name, spec := range state.Secrets {
+		switch {
+		case spec.File != "" && spec.Credential != "":
+			return desired, nil, fmt.Errorf("secret %s sets both file and credential", name)
+		case spec.File != "":
+			data, err := os.ReadFile(resolve(spec.File))
+			if err != nil {
+				return desired, nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+			}
+			desired.SecretData[name] = data
+		case spec.Credential != "":
+			server, user, ok := strings.Cut(spec.Credential, "/")
+			if !ok || server == "" || user == "" {
+				return desired, nil, fmt.Errorf("malformed credential %q of secret %s, expected server/username", spec.Credential, name)
+			}
+			value, err := lookup(server, user)
+			if err != nil {
+				return desired, nil, err
+			}
+			desired.SecretData[name] = []byte(value)
+		default:
+			return desired, nil, fmt.Errorf("secret %s needs a file or a credential", name)
+		}
+	}
+
+	generator := template.NewGenerator()
+	generator.SetCredentialLookup(lookup)
+	for name, spec := range state.Stacks {
+		composeFile := resolve(spec.File)
+		valuesPath := spec.Values
+		if valuesPath == "" && spec.Env != "" {
+			valuesPath = values.DefaultFile
+		}
+		config, err := loadDeploymentValues(resolve(valuesPath), spec.Env)
+		if err != nil {
+			return desired, nil, err
+		}
+		completeUpdateConfig(&config)
+		if _, err := resolveFileMounts(name, &config, lookup); err != nil {
+			return desired, nil, err
+		}
+		stackYAML, err := generator.RenderStackFile(composeFile, config)
+		if err != nil {
+			return desired, nil, fmt.Errorf("stack %s: %w", name, err)
+		}
+
+		// Changes to env_files and config files redeploy the stack too
+		content := []byte(stackYAML)
+		files, err := compose.LocalFiles(content)
+		if err != nil {
+			return desired, nil, fmt.Errorf("stack %s: %w", name, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(filepath.Join(filepath.Dir(composeFile), filepath.FromSlash(file)))
+			if err != nil {
+				return desired, nil, fmt.Errorf("stack %s: failed to read %s: %w", name, file, err)
+			}
+			content = append(append(content, file...), data...)
+		}
+
+		desired.StackHashes[name] = secrets.Hash(content)
+		stacks.files[name] = composeFile
+		stacks.configs[name] = config
+		stacks.yaml[name] = stackYAML
+	}
+	return desired, stacks, nil
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+
+	for _, c := range []*cobra.Command{planCmd, applyCmd} {
+		c.Flags().StringVarP(&stateFile, "file", "f", "infra.yaml", "Desired state file")
+		c.Flags().BoolVar(&pruneState, "prune", false, "Remove objects created by apply that are no longer declared")
+	}
+	applyCmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompt")
+	applyCmd.Flags().DurationVar(&waitTimeout, "timeout", defaultWaitTimeout, timeoutUsage)
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/release"
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+var rollbackTo int
+
+var rollbackCmd = &cobra.Command{
+	Use:         "rollback [service]",
+	Short:       "Roll a service back to an earlier release",
+	Annotations: destructive,
+	Long: `Restore the image and environment of an earlier release of a service
+and wait for it to converge.
+
+Without --to, swarm rolls the service back to its previous spec using the
+service's rollback_config. With --to, the image and environment of that
+release from deploy releases are applied as an update. Services of stacks
+deployed with deploy service can be given by their short name.
+
+Example:
+  infra deploy rollback orders --ip 192.168.1.10
+  infra deploy rollback orders --to 3 --ip 192.168.1.10`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serverIP == "" {
+			return fmt.Errorf("server IP is required")
+		}
+		service, err := resolveService(args[0])
+		if err != nil {
+			return err
+		}
+
+		since, err := deployStart()
+		if err != nil {
+			return err
+		}
+		if rollbackTo == 0 {
+			fmt.Printf("Rolling back %s to its previous spec\n", service)
+			if _, err := executeRemoteCommand(serverIP, username, password,
+				fmt.Sprintf("docker service rollback --detach --quiet %s", service)); err != nil {
+				return fmt.Errorf("failed to roll back service: %w", err)
+			}
+			return waitForRollback(service, since, swarm.WaitForRollback)
+		}
+
+		target, err := release.Get(serverIP, username, password, service, rollbackTo)
+		if err != nil {
+			return err
+		}
+		current, err := release.Current(serverIP, username, password, service)
+		if err != nil {
+			return err
+		}
+		if current.Same(target) {
+			fmt.Printf("Service %s already runs release %d\n", service, target.Number)
+			return nil
+		}
+
+		fmt.Printf("Rolling back %s to release %d (%s)\n", service, target.Number, target.Image)
+		if _, err := executeRemoteCommand(serverIP, username, password, releaseUpdate(service, current, target)); err != nil {
+			return fmt.Errorf("failed to roll back service: %w", err)
+		}
+		return waitForRollback(service, since, swarm.WaitForService)
+	},
+}
+
+var releasesCmd = &cobra.Command{
+	Use:   "releases [service]",
+	Short: "List the recorded releases of a service",
+	Long: `List the releases of a service that deploy rollback --to can restore.
+
+A release is recorded each time a deployment of the service becomes healthy
+with a new image or environment.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serverIP == "" {
+			return fmt.Errorf("server IP is required")
+		}
+		service, err := resolveService(args[0])
+		if err != nil {
+			return err
+		}
+		releases, err := release.List(serverIP, username, password, service)
+		if err != nil {
+			return err
+		}
+		if len(releases) == 0 {
+			fmt.Printf("No releases recorded for %s\n", service)
+			return nil
+		}
+		current, err := release.Current(serverIP, username, password, service)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RELEASE\tDEPLOYED\tIMAGE\tENV\tCURRENT")
+		for _, r := range releases {
+			marker := ""
+			if r.Same(current) {
+				marker = "*"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", r.Number, r.Time.Local().Format(time.RFC3339), r.Image, len(r.Env), marker)
+		}
+		return w.Flush()
+	},
+}
+
+// resolveService returns the swarm service named name, or the service of
+// the same name in stack name as created by deploy service
+func resolveService(name string) (string, error) {
+	candidates := []string{name, name + "_" + name}
+	states, err := swarm.ServiceStates(serverIP, username, password, "name="+name, candidates...)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range candidates {
+		for _, state := range states {
+			if state.Name == candidate {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("service %s not found", name)
+}
+
+// releaseUpdate returns the docker service update command that replaces the
+// image and environment of current with those of target
+func releaseUpdate(service string, current, target release.Release) string {
+	args := []string{"docker service update", "--detach", "--quiet", "--with-registry-auth",
+		"--image " + utils.ShellQuote(target.Image)}
+	wanted := make(map[string]bool, len(target.Env))
+	for _, env := range target.Env {
+		key, _, _ := strings.Cut(env, "=")
+		wanted[key] = true
+	}
+	for _, env := range current.Env {
+		if key, _, _ := strings.Cut(env, "="); !wanted[key] {
+			args = append(args, "--env-rm "+utils.ShellQuote(key))
+		}
+	}
+	// --env-add replaces an existing value of the same key
+	for _, env := range target.Env {
+		args = append(args, "--env-add "+utils.ShellQuote(env))
+	}
+	return strings.Join(append(args, service), " ")
+}
+
+// waitForRollback waits for service with wait unless --timeout is 0, then
+// records the restored release
+func waitForRollback(service string, since time.Time, wait func(ip, username, password, service string, since time.Time, timeout time.Duration) error) error {
+	if waitTimeout <= 0 {
+		fmt.Printf("Rollback of %s started; no release recorded since --timeout 0 skips the health check\n", service)
+		return nil
+	}
+	fmt.Printf("Waiting up to %s for %s to become healthy\n", waitTimeout, service)
+	if err := wait(serverIP, username, password, service, since, waitTimeout); err != nil {
+		return err
+	}
+	latest, _, err := release.Record(serverIP, username, password, service)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Service %s rolled back and healthy, running %s\n", service, latest.Image)
+	return nil
+}
+
+func init() {
+	deployCmd.AddCommand(rollbackCmd)
+	deployCmd.AddCommand(releasesCmd)
+
+	rollbackCmd.Flags().IntVar(&rollbackTo, "to", 0, "Release to restore, as listed by deploy releases (defaults to the previous spec)")
+}
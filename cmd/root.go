@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/config"
+	"github.com/cploutarchou/swarmforge/pkg/types"
 )
 
 // Common variables used across commands
@@ -16,8 +21,10 @@ var (
 	serviceName string
 	appType     string
 	appLang     string
+	imageTag    string
 	port        int
 	replicas    int
+	nodeRole    string
 
 	// Domain configuration
 	domain    string
@@ -30,27 +37,244 @@ var (
 	managerIP      string
 	migrateTraefik bool
 
+	// SSH credentials for managerIP, from its inventory node unless --user
+	// or --password is given
+	managerUser     string
+	managerPassword string
+
 	// Common flags
 	force      bool
 	skipBackup bool
 	useTraefik bool
+
+	// Configuration file
+	configPath    string
+	contextName   string
+	activeContext string
+	infraConfig   = &types.InfraConfig{}
+	infraDefaults types.Defaults
 )
 
+// annotationDestructive marks commands that change remote state. They print
+// the active context before running so nobody targets the wrong cluster.
+const annotationDestructive = "destructive"
+
+var destructive = map[string]string{annotationDestructive: "true"}
+
 var rootCmd = &cobra.Command{
 	Use:   "infra",
 	Short: "Infrastructure management CLI",
 	Long: `A CLI tool for managing infrastructure services, deployments, and Docker Swarm operations.
 Complete documentation is available at https://github.com/yourusername/infrastructure-setup`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd)
+	},
 }
 
 func Execute() error {
+	expandTargets(rootCmd)
 	return rootCmd.Execute()
 }
 
+// applyConfig loads the configuration file and fills in every setting that
+// was not given explicitly on the command line.
+func applyConfig(cmd *cobra.Command) error {
+	path, err := resolveConfigPath(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	configPath = path
+	infraConfig = cfg
+
+	if infraDefaults, err = config.Defaults(cfg); err != nil {
+		return err
+	}
+	if err := types.RegisterRoles(cfg.Roles); err != nil {
+		return err
+	}
+
+	if cmd.Annotations[annotationDestructive] == "true" {
+		if activeContext != "" {
+			fmt.Printf("Context: %s\n", activeContext)
+		} else {
+			fmt.Printf("Context: none (config %s)\n", configPath)
+		}
+	}
+
+	flags := cmd.Flags()
+	changed := func(name string) bool {
+		return flags.Lookup(name) != nil && flags.Changed(name)
+	}
+
+	if !changed("user") && cfg.Auth.Username != "" {
+		username = cfg.Auth.Username
+	}
+	if !changed("password") && cfg.Auth.Password != "" {
+		password = cfg.Auth.Password
+	}
+	if !changed("domain") && domain == "" {
+		domain = cfg.Domain.Base
+	}
+	if !changed("email") && email == "" {
+		email = cfg.Domain.Email
+	}
+
+	// Node names are accepted wherever a single address is expected
+	for _, addr := range []*string{&managerIP, &sourceIP, &targetIP} {
+		if *addr == "" {
+			continue
+		}
+		if *addr, err = cfg.ResolveAddress(*addr); err != nil {
+			return err
+		}
+	}
+
+	managers := cfg.Managers()
+	if len(managers) > 0 && !changed("manager-ip") && managerIP == "" {
+		managerIP = managers[0].Address
+	}
+	managerUser, managerPassword = username, password
+	for _, node := range cfg.Inventory() {
+		if node.Address == managerIP {
+			managerUser, managerPassword = nodeCredentials(cmd, node, username, password)
+			break
+		}
+	}
+	if len(managers) == 0 {
+		return nil
+	}
+	manager := managers[0]
+
+	// Credential commands use --server as a filter, and swarm join without
+	// --ip joins every configured node, so neither defaults to the manager.
+	if isSubcommandOf(cmd, authCmd) || cmd == joinCmd {
+		return nil
+	}
+	if !changed("ip") && serverIP == "" {
+		serverIP = manager.Name
+		// --role describes the node being added or provisioned for these
+		// commands, so it must not default to the manager's role
+		if !changed("role") && serverRole == "" && !describesNode(cmd) {
+			serverRole = string(types.ManagerServer)
+		}
+	}
+	return nil
+}
+
+// describesNode reports whether cmd works on node definitions rather than
+// on the manager: inventory, node and template commands
+func describesNode(cmd *cobra.Command) bool {
+	return isSubcommandOf(cmd, inventoryCmd) || isSubcommandOf(cmd, nodeCmd) || isSubcommandOf(cmd, templateCmd)
+}
+
+// nodeCredentials returns the SSH user and password for node: its own
+// unless --user or --password is given, else user and pass
+func nodeCredentials(cmd *cobra.Command, node types.NodeConfig, user, pass string) (string, string) {
+	if node.User != "" && !cmd.Flags().Changed("user") {
+		user = node.User
+	}
+	if node.Password != "" && !cmd.Flags().Changed("password") {
+		pass = node.Password
+	}
+	return user, pass
+}
+
+// expandTargets wraps every command so that --ip accepts a node name or a
+// group from the inventory. A group runs the command once per member node.
+func expandTargets(cmd *cobra.Command) {
+	for _, sub := range cmd.Commands() {
+		expandTargets(sub)
+	}
+	if cmd.RunE == nil || isSubcommandOf(cmd, inventoryCmd) || isSubcommandOf(cmd, contextCmd) ||
+		isSubcommandOf(cmd, nodeCmd) || isSubcommandOf(cmd, templateCmd) || cmd == scaffoldCmd {
+		return
+	}
+
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if serverIP == "" {
+			return run(cmd, args)
+		}
+		nodes := infraConfig.ResolveTarget(serverIP)
+		if len(nodes) == 0 {
+			return run(cmd, args)
+		}
+
+		target, user, pass, role := serverIP, username, password, serverRole
+		defer func() { serverIP, username, password, serverRole = target, user, pass, role }()
+
+		var failed []string
+		for _, node := range nodes {
+			serverIP = node.Address
+			username, password = nodeCredentials(cmd, node, user, pass)
+			if !cmd.Flags().Changed("role") {
+				serverRole = node.Role.String()
+			}
+
+			if len(nodes) > 1 {
+				fmt.Printf("==> %s (%s)\n", node.Name, node.Address)
+			}
+			if err := run(cmd, args); err != nil {
+				if len(nodes) == 1 {
+					return err
+				}
+				fmt.Printf("Error on %s: %v\n", node.Name, err)
+				failed = append(failed, node.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("command failed on: %v", failed)
+		}
+		return nil
+	}
+}
+
+// resolveConfigPath picks the configuration file: an explicit --config wins,
+// then the --context flag, then the current context, then the default file.
+func resolveConfigPath(cmd *cobra.Command) (string, error) {
+	if cmd.Flags().Changed("config") {
+		return configPath, nil
+	}
+
+	name := contextName
+	if name == "" {
+		current, err := config.CurrentContext()
+		if err != nil {
+			return "", err
+		}
+		name = current
+	}
+	if name == "" {
+		return configPath, nil
+	}
+
+	if !config.ContextExists(name) && !isSubcommandOf(cmd, contextCmd) {
+		return "", fmt.Errorf("context %s does not exist", name)
+	}
+	activeContext = name
+	return config.ContextPath(name)
+}
+
+func isSubcommandOf(cmd, parent *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == parent {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	// Add persistent flags that will be available to all commands
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", config.DefaultPath(), "Configuration file")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "Context to use instead of the current one")
 	rootCmd.PersistentFlags().StringVar(&serverIP, "ip", "", "Server IP address")
 	rootCmd.PersistentFlags().StringVar(&username, "user", "root", "SSH username")
 	rootCmd.PersistentFlags().StringVar(&password, "password", "", "SSH password")
-	rootCmd.PersistentFlags().StringVar(&serverRole, "role", "", "Server role (manager, gitlab, monitor, apps)")
+	rootCmd.PersistentFlags().StringVar(&serverRole, "role", "", "Server role (manager, gitlab, monitor, apps or a custom role)")
 }
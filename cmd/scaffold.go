@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+var scaffoldDir string
+
+var scaffoldCmd = &cobra.Command{
+	Use:   "scaffold",
+	Short: "Generate a Dockerfile and stack file for a service",
+	Long: `Generate a multi-stage Dockerfile and a stack file for a new service.
+
+The language selects the build and runtime images, the default port and a
+healthcheck that works with the tools in the runtime image. deploy service
+uses the same language profiles.
+
+Example:
+  infra scaffold --name api --lang go --type api --output ./api`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile, err := template.ProfileFor(types.Language(appLang))
+		if err != nil {
+			return err
+		}
+		if _, err := template.DeploymentTemplate(types.AppType(appType)); err != nil {
+			return err
+		}
+
+		config, err := loadDeploymentValues("", "")
+		if err != nil {
+			return err
+		}
+		config.ServiceName = serviceName
+		config.AppType = types.AppType(appType)
+		config.Language = profile.Language
+		config.ImageName = serviceName
+		config.Port = port
+		config.Environment = []string{"SERVICE_NAME=" + serviceName}
+		if err := completeDeployment(&config); err != nil {
+			return err
+		}
+		if def, ok := types.GetRoleDefinition(types.AppsServer); ok {
+			config.Placement = def.Placement
+		}
+
+		generator := template.NewGenerator()
+		dockerfile, err := generator.Render(profile.Dockerfile, config)
+		if err != nil {
+			return err
+		}
+		stack, err := generator.GenerateDeployment(config)
+		if err != nil {
+			return err
+		}
+
+		files := map[string]string{
+			"Dockerfile":      dockerfile,
+			"deployment.yaml": stack,
+		}
+		if !force {
+			for name := range files {
+				path := filepath.Join(scaffoldDir, name)
+				if _, err := os.Stat(path); err == nil {
+					return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+				}
+			}
+		}
+
+		if err := os.MkdirAll(scaffoldDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		for _, name := range []string{"Dockerfile", "deployment.yaml"} {
+			path := filepath.Join(scaffoldDir, name)
+			if err := os.WriteFile(path, []byte(files[name]), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+			fmt.Printf("Wrote %s\n", path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scaffoldCmd)
+
+	scaffoldCmd.Flags().StringVar(&serviceName, "name", "", "Service name")
+	scaffoldCmd.Flags().StringVar(&appType, "type", string(types.APIApp), "Application type (api, standalone)")
+	scaffoldCmd.Flags().StringVar(&appLang, "lang", "", "Application language (go, python, node, java)")
+	scaffoldCmd.Flags().IntVar(&port, "port", 0, "Service port (defaults to the language's port)")
+	scaffoldCmd.Flags().StringVarP(&scaffoldDir, "output", "o", ".", "Directory to write the files to")
+	scaffoldCmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+
+	scaffoldCmd.MarkFlagRequired("name")
+	scaffoldCmd.MarkFlagRequired("lang")
+}
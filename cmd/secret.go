@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+)
+
+var (
+	secretEntries []string
+	pruneSecrets  bool
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage Docker Swarm secrets",
+	Long:  `Commands for publishing stored credentials as Docker Swarm secrets.`,
+}
+
+var syncSecretsCmd = &cobra.Command{
+	Use:         "sync",
+	Short:       "Sync stored credentials into swarm secrets",
+	Annotations: destructive,
+	Long: `Publish selected credentials as versioned swarm secrets.
+
+Each entry maps a secret name to a stored credential as name=server/username.
+Secrets are named <name>_<hash> after their content, and services that use an
+older version of a secret are updated to the new one.
+
+Example:
+  infra secret sync --ip 192.168.1.10 --entry db_password=192.168.1.20/postgres --prune`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serverIP == "" {
+			return fmt.Errorf("server IP is required")
+		}
+		if len(secretEntries) == 0 {
+			return fmt.Errorf("at least one --entry is required")
+		}
+
+		store, err := openCredentialStore("Enter master key for decryption: ")
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		var items []secrets.Item
+		for _, entry := range secretEntries {
+			name, ref, ok := strings.Cut(entry, "=")
+			server, user, refOK := strings.Cut(ref, "/")
+			if !ok || !refOK || name == "" || server == "" || user == "" {
+				return fmt.Errorf("invalid entry %q, expected name=server/username", entry)
+			}
+
+			cred, err := store.GetCredentials(server, user)
+			if err != nil {
+				return err
+			}
+			if cred == nil {
+				return fmt.Errorf("no stored credentials for %s@%s", user, server)
+			}
+			items = append(items, secrets.Item{Name: name, Data: []byte(cred.Password)})
+		}
+
+		result, err := secrets.Sync(serverIP, username, password, items, pruneSecrets)
+		if err != nil {
+			return fmt.Errorf("failed to sync secrets: %w", err)
+		}
+
+		for _, name := range result.Created {
+			fmt.Printf("Created secret %s\n", name)
+		}
+		for _, name := range result.Updated {
+			fmt.Printf("Updated service %s\n", name)
+		}
+		for _, name := range result.Pruned {
+			fmt.Printf("Pruned secret %s\n", name)
+		}
+		fmt.Println("Secrets synced successfully")
+		return nil
+	},
+}
+
+func init() {
+	secretCmd.AddCommand(syncSecretsCmd)
+	rootCmd.AddCommand(secretCmd)
+
+	syncSecretsCmd.Flags().StringArrayVar(&secretEntries, "entry", nil, "Secret to sync as name=server/username (repeatable)")
+	syncSecretsCmd.Flags().BoolVar(&pruneSecrets, "prune", false, "Remove managed secrets no service references")
+}
@@ -15,8 +15,9 @@ var serviceCmd = &cobra.Command{
 }
 
 var createServiceCmd = &cobra.Command{
-	Use:   "create [name]",
-	Short: "Create a new service",
+	Use:         "create [name]",
+	Short:       "Create a new service",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			return fmt.Errorf("service name is required")
@@ -24,18 +25,21 @@ var createServiceCmd = &cobra.Command{
 
 		serviceName := args[0]
 		config := types.DeploymentConfig{
-			ServiceName: serviceName,
-			ImageName:   fmt.Sprintf("%s-%s", serviceName, appType),
-			Port:        port,
-			Replicas:    replicas,
-			Domain:      domain,
-			Subdomain:   subdomain,
-			UseTraefik:  useTraefik,
-			Labels:      make(map[string]string),
-			Environment: map[string]string{
-				"SERVICE_NAME": serviceName,
-				"APP_PORT":     fmt.Sprintf("%d", port),
+			ServiceConfig: types.ServiceConfig{
+				ServiceName: serviceName,
+				AppType:     types.AppType(appType),
+				ImageName:   fmt.Sprintf("%s-%s", serviceName, appType),
+				Replicas:    replicas,
+				Port:        port,
+				Environment: []string{
+					"SERVICE_NAME=" + serviceName,
+					fmt.Sprintf("APP_PORT=%d", port),
+				},
+				Domain:     domain,
+				Subdomain:  subdomain,
+				UseTraefik: useTraefik,
 			},
+			Labels: make(map[string]string),
 		}
 
 		// Add service-specific configuration here
@@ -54,8 +58,9 @@ var listServiceCmd = &cobra.Command{
 }
 
 var deleteServiceCmd = &cobra.Command{
-	Use:   "delete [name]",
-	Short: "Delete a service",
+	Use:         "delete [name]",
+	Short:       "Delete a service",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			return fmt.Errorf("service name is required")
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,7 +9,9 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/cploutarchou/swarmforge/pkg/setup"
 	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/traefik"
 	"github.com/cploutarchou/swarmforge/pkg/types"
 )
 
@@ -18,13 +21,21 @@ var setupCmd = &cobra.Command{
 	Long:  `Commands for setting up infrastructure components like Traefik, monitoring, etc.`,
 }
 
+var traefikEntrypoints []string
+
 var setupTraefikCmd = &cobra.Command{
-	Use:   "traefik",
-	Short: "Setup Traefik reverse proxy",
+	Use:         "traefik",
+	Short:       "Setup Traefik reverse proxy",
+	Annotations: destructive,
 	Long: `Setup Traefik reverse proxy with automatic SSL certificate management.
-	
+
+TCP and UDP entrypoints come from traefik.entrypoints in the configuration
+and from --entrypoint, given as name=port for TCP or name=port/udp.
+
 Example:
-  infra setup traefik --ip 192.168.1.10 --domain example.com --email admin@example.com`,
+  infra setup traefik --ip 192.168.1.10 --domain example.com --email admin@example.com
+  infra setup traefik --ip 192.168.1.10 --domain example.com --email admin@example.com \
+    --entrypoint postgres=5432 --entrypoint mqtt=8883`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" || domain == "" || email == "" {
 			return fmt.Errorf("server IP, domain, and email are required")
@@ -33,8 +44,19 @@ Example:
 		// Generate Traefik configuration
 		generator := template.NewGenerator()
 		config := types.DeploymentConfig{
-			Domain: domain,
-			Email:  email,
+			ServiceConfig: types.ServiceConfig{Domain: domain},
+			Email:         email,
+			Entrypoints:   make(map[string]types.Entrypoint),
+		}
+		for name, ep := range infraConfig.Traefik.Entrypoints {
+			config.Entrypoints[name] = ep
+		}
+		for _, spec := range traefikEntrypoints {
+			name, ep, err := traefik.ParseEntrypoint(spec)
+			if err != nil {
+				return err
+			}
+			config.Entrypoints[name] = ep
 		}
 
 		traefikYAML, err := generator.GenerateTraefikConfig(config)
@@ -64,35 +86,55 @@ Example:
 
 		// Deploy Traefik
 		deployCmd := "docker stack deploy -c /tmp/traefik-init.yaml traefik"
+		since, err := deployStart()
+		if err != nil {
+			return err
+		}
 		result, err := executeRemoteCommand(serverIP, username, password, deployCmd)
 		if err != nil {
 			return fmt.Errorf("failed to deploy Traefik: %w", err)
 		}
+		fmt.Println(result)
+		if err := waitForStack("traefik", since); err != nil {
+			return err
+		}
 
 		fmt.Println("Traefik setup completed successfully")
 		fmt.Printf("Traefik dashboard available at: https://traefik.%s\n", domain)
-		fmt.Println(result)
 
 		return nil
 	},
 }
 
 var setupServersCmd = &cobra.Command{
-	Use:   "servers",
-	Short: "Setup all servers",
+	Use:         "servers",
+	Short:       "Setup all servers",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
 		}
 
+		daemonConfig, err := json.Marshal(map[string]interface{}{
+			"log-driver": infraDefaults.Docker.LogDriver,
+			"log-opts":   infraDefaults.Docker.LogOpts,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode Docker daemon config: %w", err)
+		}
+
 		// Update system and install dependencies
 		setupCmds := []string{
 			"apt-get update",
 			"apt-get upgrade -y",
 			"apt-get install -y curl wget git",
-			"curl -fsSL https://get.docker.com | sh",
+			fmt.Sprintf("curl -fsSL https://get.docker.com | VERSION=%s sh", infraDefaults.Docker.Version),
+			fmt.Sprintf("mkdir -p /etc/docker && echo '%s' > /etc/docker/daemon.json", daemonConfig),
 			"systemctl enable docker",
-			"systemctl start docker",
+			"systemctl restart docker",
+		}
+		if infraDefaults.Security.Fail2banEnabled {
+			setupCmds = append(setupCmds, "apt-get install -y fail2ban", "systemctl enable --now fail2ban")
 		}
 
 		for _, cmd := range setupCmds {
@@ -112,25 +154,22 @@ var setupServersCmd = &cobra.Command{
 }
 
 var setupFirewallCmd = &cobra.Command{
-	Use:   "firewall",
-	Short: "Setup firewall rules",
+	Use:         "firewall",
+	Short:       "Setup firewall rules",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
 		}
 
-		// Setup firewall rules
-		firewallCmds := []string{
-			"ufw allow OpenSSH",
-			"ufw allow 80/tcp",   // HTTP
-			"ufw allow 443/tcp",  // HTTPS
-			"ufw allow 2377/tcp", // Docker Swarm cluster management
-			"ufw allow 7946/tcp", // Container network discovery
-			"ufw allow 7946/udp",
-			"ufw allow 4789/udp", // Container overlay network
-			"ufw --force enable",
+		if !infraDefaults.Security.FirewallEnabled {
+			fmt.Println("Firewall disabled by security.firewall_enabled, skipping")
+			return nil
 		}
 
+		// Setup firewall rules
+		firewallCmds := append(firewallRules(types.ServerRole(serverRole)), "ufw --force enable")
+
 		for _, cmd := range firewallCmds {
 			command := exec.Command("sshpass", "-p", password, "ssh",
 				"-o", "StrictHostKeyChecking=no",
@@ -147,6 +186,37 @@ var setupFirewallCmd = &cobra.Command{
 	},
 }
 
+// firewallRules returns the ufw rules for the SSH port, the allowed ports
+// from the security defaults, the monitoring ports on monitor nodes and the
+// ports declared by the node's role.
+func firewallRules(role types.ServerRole) []string {
+	rules := []string{fmt.Sprintf("ufw allow %d/tcp", infraDefaults.Security.SSHPort)}
+
+	for _, port := range infraDefaults.Security.AllowedPorts {
+		switch port {
+		case 7946: // Container network discovery
+			rules = append(rules, "ufw allow 7946/tcp", "ufw allow 7946/udp")
+		case 4789: // Container overlay network
+			rules = append(rules, "ufw allow 4789/udp")
+		default:
+			rules = append(rules, fmt.Sprintf("ufw allow %d/tcp", port))
+		}
+	}
+
+	if role == types.MonitorServer {
+		monitoring := infraDefaults.Monitoring
+		for _, port := range []int{monitoring.PrometheusPort, monitoring.GrafanaPort, monitoring.NodeExporterPort, monitoring.CadvisorPort} {
+			rules = append(rules, fmt.Sprintf("ufw allow %d/tcp", port))
+		}
+	}
+
+	if def, ok := types.GetRoleDefinition(role); ok {
+		rules = append(rules, setup.FirewallCommands(def)...)
+	}
+
+	return rules
+}
+
 func init() {
 	// Add subcommands
 	setupCmd.AddCommand(setupServersCmd)
@@ -159,6 +229,6 @@ func init() {
 	// Add flags
 	setupTraefikCmd.Flags().StringVar(&email, "email", "", "Email address for Let's Encrypt")
 	setupTraefikCmd.Flags().StringVar(&domain, "domain", "", "Domain name for Traefik dashboard")
-	setupTraefikCmd.MarkFlagRequired("email")
-	setupTraefikCmd.MarkFlagRequired("domain")
+	setupTraefikCmd.Flags().DurationVar(&waitTimeout, "timeout", defaultWaitTimeout, timeoutUsage)
+	setupTraefikCmd.Flags().StringSliceVar(&traefikEntrypoints, "entrypoint", nil, "TCP or UDP entrypoint as name=port[/udp] (repeatable)")
 }
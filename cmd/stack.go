@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+	"github.com/cploutarchou/swarmforge/pkg/stack"
+	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+var (
+	stackName   string
+	packParams  []string
+	packVersion string
+	dryRun      bool
+)
+
+var stackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "Install stack packs for backing services",
+	Long: `Commands for installing curated stacks for common backing services.
+
+Each pack places its service on a role, keeps its data on a named volume,
+stores a generated password as a swarm secret and defines a healthcheck.`,
+}
+
+var listPacksCmd = &cobra.Command{
+	Use:   "packs",
+	Short: "List available stack packs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tPARAMETERS\tDESCRIPTION")
+		for _, pack := range stack.Packs() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pack.Name, pack.Version, formatLabels(pack.Params), pack.Description)
+		}
+		return w.Flush()
+	},
+}
+
+var addStackCmd = &cobra.Command{
+	Use:         "add [pack]",
+	Short:       "Install a stack pack",
+	Annotations: destructive,
+	Long: `Render a stack pack and deploy it.
+
+Generated passwords are created as swarm secrets named
+<stack>_<pack>_<secret> the first time a pack is installed and kept on later
+installs. The service is placed on nodes of --node-role.
+
+Example:
+  infra stack add postgres --name orders-db --set database=orders --node-role db
+  infra stack add redis --dry-run`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pack, err := stack.Get(args[0])
+		if err != nil {
+			return err
+		}
+		name := stackName
+		if name == "" {
+			name = pack.Name
+		}
+
+		overrides, err := parseLabels(packParams)
+		if err != nil {
+			return err
+		}
+		data, err := pack.Data(name, overrides)
+		if err != nil {
+			return err
+		}
+		if packVersion != "" {
+			data.Version = packVersion
+		}
+		role, ok := types.GetRoleDefinition(types.ServerRole(nodeRole))
+		if !ok {
+			return fmt.Errorf("invalid node role. Valid roles are: %v", types.ValidServerRoles())
+		}
+		data.Placement = role.Placement
+
+		stackYAML, err := pack.Render(template.NewGenerator(), data)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Print(stackYAML)
+			return nil
+		}
+
+		if serverIP == "" {
+			return fmt.Errorf("server IP is required")
+		}
+		for _, secret := range pack.Secrets {
+			secretName := data.Secrets[secret]
+			created, err := secrets.Ensure(serverIP, username, password, secretName, stack.GeneratePassword)
+			if err != nil {
+				return err
+			}
+			if created {
+				fmt.Printf("Created secret %s\n", secretName)
+			}
+		}
+
+		localFile := filepath.Join(os.TempDir(), name+".yaml")
+		if err := os.WriteFile(localFile, []byte(stackYAML), 0600); err != nil {
+			return fmt.Errorf("failed to write stack file: %w", err)
+		}
+		defer os.Remove(localFile)
+
+		remoteFile := fmt.Sprintf("/tmp/%s.yaml", name)
+		if err := copyToServer(localFile, remoteFile); err != nil {
+			return err
+		}
+		since, err := deployStart()
+		if err != nil {
+			return err
+		}
+		result, err := executeRemoteCommand(serverIP, username, password,
+			fmt.Sprintf("docker stack deploy -c %s %s", remoteFile, name))
+		if err != nil {
+			return fmt.Errorf("failed to deploy stack: %w", err)
+		}
+
+		if out := strings.TrimSpace(result); out != "" {
+			fmt.Println(out)
+		}
+		if err := waitForStack(name, since); err != nil {
+			return err
+		}
+		fmt.Printf("Stack %s installed from pack %s\n", name, pack.Name)
+		return nil
+	},
+}
+
+func init() {
+	// Add subcommands
+	stackCmd.AddCommand(listPacksCmd)
+	stackCmd.AddCommand(addStackCmd)
+
+	// Add to root command
+	rootCmd.AddCommand(stackCmd)
+
+	// Add flags
+	addStackCmd.Flags().StringVar(&stackName, "name", "", "Stack name (defaults to the pack name)")
+	addStackCmd.Flags().StringSliceVar(&packParams, "set", nil, "Pack parameter as key=value (repeatable)")
+	addStackCmd.Flags().StringVar(&packVersion, "version", "", "Image version (defaults to the pack's version)")
+	addStackCmd.Flags().StringVar(&nodeRole, "node-role", string(types.AppsServer), "Role of the nodes the stack is placed on")
+	addStackCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the rendered stack without deploying it")
+	addStackCmd.Flags().DurationVar(&waitTimeout, "timeout", defaultWaitTimeout, timeoutUsage)
+}
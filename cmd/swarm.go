@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/cploutarchou/swarmforge/pkg/setup"
 	"github.com/cploutarchou/swarmforge/pkg/types"
 )
 
@@ -23,8 +24,9 @@ var swarmCmd = &cobra.Command{
 }
 
 var initCmd = &cobra.Command{
-	Use:   "init",
-	Short: "Initialize a new swarm",
+	Use:         "init",
+	Short:       "Initialize a new swarm",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
@@ -36,7 +38,7 @@ var initCmd = &cobra.Command{
 		}
 
 		// Initialize swarm
-		initCmd := fmt.Sprintf("docker swarm init --advertise-addr %s", serverIP)
+		initCmd := fmt.Sprintf("docker swarm init --advertise-addr %s", swarmAdvertiseAddr(serverIP))
 		result, err := executeRemoteCommand(serverIP, username, password, initCmd)
 		if err != nil {
 			return fmt.Errorf("failed to initialize swarm: %w", err)
@@ -72,68 +74,84 @@ var initCmd = &cobra.Command{
 }
 
 var joinCmd = &cobra.Command{
-	Use:   "join",
-	Short: "Join a node to the swarm",
+	Use:         "join",
+	Short:       "Join a node to the swarm",
+	Annotations: destructive,
+	Long: `Join a node to the swarm and configure it for its role.
+
+--ip accepts an address, a node name or a group from the inventory. Without
+--ip every non-manager node in the inventory is joined.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if serverIP == "" || managerIP == "" {
-			return fmt.Errorf("server IP and manager IP are required")
+		if managerIP == "" {
+			return fmt.Errorf("manager IP is required")
 		}
 
-		if !types.IsValidServerRole(serverRole) {
-			return fmt.Errorf("invalid server role. Valid roles are: %v", types.ValidServerRoles())
+		if serverIP != "" {
+			return joinNode(serverIP, username, password, serverRole)
 		}
 
-		// Get join token based on role
-		var token string
-		var err error
-		if serverRole == string(types.ManagerServer) {
-			token, err = getSwarmToken(managerIP, username, password, "manager")
-		} else {
-			token, err = getSwarmToken(managerIP, username, password, "worker")
+		var joined int
+		for _, node := range infraConfig.Inventory() {
+			if node.Role == types.ManagerServer {
+				continue
+			}
+			user, pass := nodeCredentials(cmd, node, username, password)
+			if err := joinNode(node.Address, user, pass, node.Role.String()); err != nil {
+				return fmt.Errorf("failed to join %s: %w", node.Name, err)
+			}
+			joined++
 		}
-		if err != nil {
-			return fmt.Errorf("failed to get join token: %w", err)
+		if joined == 0 {
+			return fmt.Errorf("server IP is required")
 		}
+		return nil
+	},
+}
 
-		// Join swarm
-		joinCmd := fmt.Sprintf("docker swarm join --token %s %s:2377", token, managerIP)
-		result, err := executeRemoteCommand(serverIP, username, password, joinCmd)
-		if err != nil {
-			return fmt.Errorf("failed to join swarm: %w", err)
-		}
+func joinNode(nodeIP, user, pass, nodeRole string) error {
+	if !types.IsValidServerRole(nodeRole) {
+		return fmt.Errorf("invalid server role. Valid roles are: %v", types.ValidServerRoles())
+	}
 
-		fmt.Printf("Node %s joined the swarm successfully\n", serverIP)
-		fmt.Println(result)
+	// Get join token based on role
+	var token string
+	var err error
+	if nodeRole == string(types.ManagerServer) {
+		token, err = getSwarmToken(managerIP, managerUser, managerPassword, "manager")
+	} else {
+		token, err = getSwarmToken(managerIP, managerUser, managerPassword, "worker")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get join token: %w", err)
+	}
 
-		// Apply role-specific labels
-		role := types.ServerRole(serverRole)
-		labels := types.GetServerLabels(role)
-		for key, value := range labels {
-			labelCmd := fmt.Sprintf("docker node update --label-add %s=%s %s", key, value, serverIP)
-			if _, err := executeRemoteCommand(managerIP, username, password, labelCmd); err != nil {
-				return fmt.Errorf("failed to apply labels: %w", err)
-			}
-		}
+	// Join swarm
+	joinCmd := fmt.Sprintf("docker swarm join --advertise-addr %s --token %s %s:2377", swarmAdvertiseAddr(nodeIP), token, managerIP)
+	result, err := executeRemoteCommand(nodeIP, user, pass, joinCmd)
+	if err != nil {
+		return fmt.Errorf("failed to join swarm: %w", err)
+	}
 
-		// Setup role-specific configurations
-		switch role {
-		case types.GitlabServer:
-			if err := setupGitlabNode(serverIP, username, password); err != nil {
-				return fmt.Errorf("failed to setup Gitlab node: %w", err)
-			}
-		case types.MonitorServer:
-			if err := setupMonitorNode(serverIP, username, password); err != nil {
-				return fmt.Errorf("failed to setup Monitor node: %w", err)
-			}
-		case types.AppsServer:
-			if err := setupAppsNode(serverIP, username, password); err != nil {
-				return fmt.Errorf("failed to setup Apps node: %w", err)
-			}
+	fmt.Printf("Node %s joined the swarm successfully\n", nodeIP)
+	fmt.Println(result)
+
+	// Apply role-specific labels
+	role := types.ServerRole(nodeRole)
+	labels := types.GetServerLabels(role)
+	for key, value := range labels {
+		labelCmd := fmt.Sprintf("docker node update --label-add %s=%s %s", key, value, nodeIP)
+		if _, err := executeRemoteCommand(managerIP, managerUser, managerPassword, labelCmd); err != nil {
+			return fmt.Errorf("failed to apply labels: %w", err)
 		}
+	}
 
-		fmt.Printf("Node labeled and configured with role: %s\n", serverRole)
-		return nil
-	},
+	// Setup role-specific configurations
+	if err := setup.ApplyRole(nodeIP, user, pass, role); err != nil {
+		return fmt.Errorf("failed to setup %s node: %w", role, err)
+	}
+
+	fmt.Printf("Node labeled and configured with role: %s\n", nodeRole)
+	return nil
 }
 
 var statsCmd = &cobra.Command{
@@ -168,58 +186,6 @@ var statsCmd = &cobra.Command{
 	},
 }
 
-func setupGitlabNode(ip, user, pass string) error {
-	// Setup Gitlab-specific requirements
-	cmds := []string{
-		"apt-get update",
-		"apt-get install -y ca-certificates curl openssh-server",
-		"mkdir -p /etc/gitlab/config",
-		"mkdir -p /var/log/gitlab",
-		"mkdir -p /var/opt/gitlab",
-	}
-
-	for _, cmd := range cmds {
-		if _, err := executeRemoteCommand(ip, user, pass, cmd); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func setupMonitorNode(ip, user, pass string) error {
-	// Setup monitoring-specific requirements
-	cmds := []string{
-		"apt-get update",
-		"apt-get install -y prometheus-node-exporter",
-		"mkdir -p /etc/prometheus",
-		"mkdir -p /var/lib/prometheus",
-	}
-
-	for _, cmd := range cmds {
-		if _, err := executeRemoteCommand(ip, user, pass, cmd); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func setupAppsNode(ip, user, pass string) error {
-	// Setup application node requirements
-	cmds := []string{
-		"apt-get update",
-		"apt-get install -y docker-compose-plugin",
-		"mkdir -p /app/data",
-		"mkdir -p /app/config",
-	}
-
-	for _, cmd := range cmds {
-		if _, err := executeRemoteCommand(ip, user, pass, cmd); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func init() {
 	// Add subcommands
 	swarmCmd.AddCommand(initCmd)
@@ -231,9 +197,23 @@ func init() {
 
 	// Add flags
 	joinCmd.Flags().StringVar(&managerIP, "manager-ip", "", "Manager node IP address")
+	initCmd.Flags().StringVar(&advertiseAddr, "advertise-addr", "", "Advertise address (format: <ip|interface>[:port])")
 	joinCmd.Flags().StringVar(&advertiseAddr, "advertise-addr", "", "Advertise address (format: <ip|interface>[:port])")
 }
 
+// swarmAdvertiseAddr returns the --advertise-addr flag, falling back to
+// docker.swarm_advertise_addr from the defaults and then to the address of
+// node, since interface names differ between hosts
+func swarmAdvertiseAddr(node string) string {
+	if advertiseAddr != "" {
+		return advertiseAddr
+	}
+	if infraDefaults.Docker.SwarmAdvertiseAddr != "" {
+		return infraDefaults.Docker.SwarmAdvertiseAddr
+	}
+	return node
+}
+
 func getSwarmToken(ip, user, pass, role string) (string, error) {
 	cmd := fmt.Sprintf("docker swarm join-token -q %s", role)
 	result, err := executeRemoteCommand(ip, user, pass, cmd)
@@ -14,8 +14,9 @@ var systemCmd = &cobra.Command{
 }
 
 var updateCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update system packages",
+	Use:         "update",
+	Short:       "Update system packages",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
@@ -39,8 +40,9 @@ var updateCmd = &cobra.Command{
 }
 
 var hardenCmd = &cobra.Command{
-	Use:   "harden",
-	Short: "Apply security hardening",
+	Use:         "harden",
+	Short:       "Apply security hardening",
+	Annotations: destructive,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if serverIP == "" {
 			return fmt.Errorf("server IP is required")
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cploutarchou/swarmforge/pkg/template"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/values"
+)
+
+var (
+	valuesFile    string
+	valuesEnv     string
+	validateStack bool
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage deployment templates",
+	Long: `Commands for inspecting and previewing deployment templates.
+
+Templates are looked up in ./.infra/templates, then ~/.infra/templates and
+finally in the templates built into the binary. A file in a user directory
+shadows the built-in template with the same name, so copying a template with
+"infra template show" is a good starting point for an override.`,
+}
+
+var listTemplateCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List templates on the search path",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		templates, err := template.NewGenerator().List()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSOURCE\tSHADOWS")
+		for _, info := range templates {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", info.Name, info.Source, strings.Join(info.Shadows, ","))
+		}
+		return w.Flush()
+	},
+}
+
+var showTemplateCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print a template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		content, _, err := template.NewGenerator().Read(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(content)
+		return err
+	},
+}
+
+var renderTemplateCmd = &cobra.Command{
+	Use:   "render [name]",
+	Short: "Render a template with a values file",
+	Long: `Render a template to stdout without deploying anything.
+
+The values file uses the deployment fields (service_name, app_type,
+image_name, version, replicas, port, environment, labels, placement, ...)
+and a free-form values map for user templates. Resources, replicas and
+logging fall back to the configured defaults. Without a name the template
+is chosen from app_type.
+
+Templates can use quote, toYaml, indent, nindent, default, required, b64enc,
+sha256, env and credential (server, user). Referencing a missing key is an
+error. Stack templates (*.yaml, *.yml) are validated as swarm stack files
+unless --validate=false; other templates only when --validate is set.
+
+Example:
+  infra template render --values api.yaml
+  infra template render api-deployment.yaml --values api.yaml
+  infra template render --values values.yaml --env staging`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadDeploymentValues(valuesFile, valuesEnv)
+		if err != nil {
+			return err
+		}
+		if err := completeDeployment(&config); err != nil {
+			return err
+		}
+
+		generator := template.NewGenerator()
+		lookup, _, closeStore := credentialLookup()
+		defer closeStore()
+		generator.SetCredentialLookup(lookup)
+
+		// Previews name configs and secrets without publishing them
+		if _, err := resolveFileMounts(config.ServiceName, &config, lookup); err != nil {
+			return err
+		}
+
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		} else if name, err = template.DeploymentTemplate(config.AppType); err != nil {
+			return err
+		}
+
+		validate := validateStack
+		if !cmd.Flags().Changed("validate") {
+			ext := strings.ToLower(filepath.Ext(name))
+			validate = ext == ".yaml" || ext == ".yml"
+		}
+		render := generator.RenderStack
+		if !validate {
+			render = generator.Render
+		}
+		output, err := render(name, config)
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+		return nil
+	},
+}
+
+// loadDeploymentValues reads the values file at path, with the overlay for
+// env merged over it, on top of the defaults
+func loadDeploymentValues(path, env string) (types.DeploymentConfig, error) {
+	service := infraDefaults.Service
+	config := types.DeploymentConfig{
+		ServiceConfig: types.ServiceConfig{
+			AppType:  types.APIApp,
+			Version:  "latest",
+			Replicas: infraDefaults.Service.Replicas,
+		},
+		LogDriver:  infraDefaults.Docker.LogDriver,
+		LogOptions: infraDefaults.Docker.LogOpts,
+		UpdateConfig: &types.UpdateConfig{
+			Parallelism:   service.UpdateParallelism,
+			Delay:         service.UpdateDelay,
+			FailureAction: service.FailureAction,
+			Monitor:       service.UpdateMonitor,
+		},
+		// A failing rollback pauses rather than rolling back again
+		RollbackConfig: &types.UpdateConfig{
+			Parallelism:   service.UpdateParallelism,
+			Delay:         service.RollbackDelay,
+			FailureAction: "pause",
+			Monitor:       service.UpdateMonitor,
+		},
+		MaxAttempts: service.MaxAttempts,
+	}
+
+	files := values.Files(path, env)
+	if len(files) == 0 {
+		return config, nil
+	}
+	merged, err := values.Load(files...)
+	if err != nil {
+		return config, err
+	}
+	if err := values.Decode(merged, &config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// completeDeployment fills what the values and flags left unset from the
+// language profile and the resource defaults of the app type
+func completeDeployment(config *types.DeploymentConfig) error {
+	if config.Language != "" {
+		profile, err := template.ProfileFor(config.Language)
+		if err != nil {
+			return err
+		}
+		profile.Apply(&config.ServiceConfig)
+	}
+	if config.Port == 0 {
+		config.Port = 8080
+	}
+
+	resources := infraDefaults.ResourcesFor(config.AppType)
+	if config.CPU == "" {
+		config.CPU = resources.CPU
+	}
+	if config.Memory == "" {
+		config.Memory = resources.Memory
+	}
+	if config.ImageName == "" && config.ServiceName != "" {
+		config.ImageName = fmt.Sprintf("%s-%s", config.ServiceName, config.AppType)
+	}
+	completeUpdateConfig(config)
+	return nil
+}
+
+// completeUpdateConfig sets the update and rollback order the values left
+// unset. Standalone services stop the old task first, since two tasks must
+// not share their data volume.
+func completeUpdateConfig(config *types.DeploymentConfig) {
+	order := infraDefaults.Service.UpdateOrder
+	if config.AppType == types.StandaloneApp {
+		order = "stop-first"
+	}
+	for _, update := range []*types.UpdateConfig{config.UpdateConfig, config.RollbackConfig} {
+		if update != nil && update.Order == "" {
+			update.Order = order
+		}
+	}
+}
+
+func init() {
+	// Add subcommands
+	templateCmd.AddCommand(listTemplateCmd)
+	templateCmd.AddCommand(showTemplateCmd)
+	templateCmd.AddCommand(renderTemplateCmd)
+
+	// Add to root command
+	rootCmd.AddCommand(templateCmd)
+
+	// Add flags
+	renderTemplateCmd.Flags().StringVar(&valuesFile, "values", "", "Values file to render the template with")
+	renderTemplateCmd.Flags().StringVar(&valuesEnv, "env", "", "Environment whose values overlay (values.<env>.yaml) is merged over --values")
+	renderTemplateCmd.Flags().BoolVar(&validateStack, "validate", true, "Validate the output as a swarm stack file (defaults to true for *.yaml templates)")
+}
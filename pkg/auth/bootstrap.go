@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// SSHDropInPath is the sshd drop-in written when password login is disabled.
+// sshd keeps the first value it reads for an option and includes drop-ins in
+// lexical order, so the 00- prefix wins over files such as 50-cloud-init.conf.
+const SSHDropInPath = "/etc/ssh/sshd_config.d/00-infra-keys.conf"
+
+const sshDropIn = `# Managed by infra auth bootstrap-keys
+PasswordAuthentication no
+KbdInteractiveAuthentication no
+`
+
+// LoadPublicKeys reads an authorized_keys style file, skipping blank lines
+// and comments.
+func LoadPublicKeys(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open public keys: %w", err)
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "ssh-") && !strings.HasPrefix(line, "ecdsa-") && !strings.HasPrefix(line, "sk-") {
+			return nil, fmt.Errorf("invalid public key: %q", line)
+		}
+		if strings.Contains(line, "'") {
+			return nil, fmt.Errorf("public key must not contain single quotes: %q", line)
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read public keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", path)
+	}
+
+	return keys, nil
+}
+
+// BootstrapKeys moves a node from password to key based SSH login. The stored
+// password is used once to install keys into authorized_keys, after which
+// every step runs over a key login with identity. Password authentication is
+// only disabled once key login has been proven to work, and the sshd drop-in
+// is removed again if sshd -t rejects it.
+func BootstrapKeys(creds Credentials, keys []string, identity string) error {
+	if err := installKeys(creds, keys); err != nil {
+		return fmt.Errorf("failed to install keys: %w", err)
+	}
+
+	if _, err := utils.ExecuteKeyCommand(creds.Server, creds.Username, identity, "true"); err != nil {
+		return fmt.Errorf("key login failed, password login left enabled: %w", err)
+	}
+
+	sudo := ""
+	if creds.Username != "root" {
+		sudo = "sudo -n "
+	}
+
+	disableCmd := fmt.Sprintf(`
+		grep -Eqi '^Include[[:space:]]+/etc/ssh/sshd_config\.d/' /etc/ssh/sshd_config || { echo "sshd_config does not include sshd_config.d"; exit 1; }
+		printf '%%s' '%s' | %stee %s > /dev/null &&
+		%schmod 644 %s &&
+		{ %ssshd -t || { %srm -f %s; echo "sshd -t rejected configuration"; exit 1; }; } &&
+		{ %ssystemctl reload ssh 2>/dev/null || %ssystemctl reload sshd; }
+	`, sshDropIn, sudo, SSHDropInPath,
+		sudo, SSHDropInPath,
+		sudo, sudo, SSHDropInPath,
+		sudo, sudo)
+	if _, err := utils.ExecuteKeyCommand(creds.Server, creds.Username, identity, disableCmd); err != nil {
+		return fmt.Errorf("failed to disable password login: %w", err)
+	}
+
+	// Confirm the reloaded daemon still accepts the key
+	if _, err := utils.ExecuteKeyCommand(creds.Server, creds.Username, identity, "true"); err != nil {
+		return fmt.Errorf("key login failed after reload, remove %s from the console: %w", SSHDropInPath, err)
+	}
+
+	return nil
+}
+
+func installKeys(creds Credentials, keys []string) error {
+	cmds := []string{
+		"umask 077 && mkdir -p ~/.ssh && touch ~/.ssh/authorized_keys",
+	}
+	for _, key := range keys {
+		cmds = append(cmds, fmt.Sprintf("{ grep -qxF '%s' ~/.ssh/authorized_keys || echo '%s' >> ~/.ssh/authorized_keys; }", key, key))
+	}
+
+	_, err := utils.ExecuteRemoteCommand(creds.Server, creds.Username, creds.Password, strings.Join(cmds, " && "))
+	return err
+}
@@ -10,8 +10,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/scrypt"
 )
 
@@ -37,10 +39,22 @@ const (
 		password TEXT NOT NULL,
 		role TEXT,
 		UNIQUE(server, username)
+	);
+	CREATE TABLE IF NOT EXISTS password_hashes (
+		server TEXT NOT NULL,
+		username TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		UNIQUE(server, username)
 	);`
 )
 
 func NewCredentialStore(masterKey string) (*CredentialStore, error) {
+	return NewNamespacedCredentialStore(masterKey, "")
+}
+
+// NewNamespacedCredentialStore opens the credential database of a namespace.
+// The empty namespace is the shared default database.
+func NewNamespacedCredentialStore(masterKey, namespace string) (*CredentialStore, error) {
 	// Create the .infra directory in user's home if it doesn't exist
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -53,7 +67,14 @@ func NewCredentialStore(masterKey string) (*CredentialStore, error) {
 	}
 
 	// Open SQLite database
-	dbPath := filepath.Join(dbDir, "credentials.db")
+	dbName := "credentials.db"
+	if namespace != "" {
+		if strings.ContainsAny(namespace, `/\`) || strings.HasPrefix(namespace, ".") {
+			return nil, fmt.Errorf("invalid credential namespace %q", namespace)
+		}
+		dbName = fmt.Sprintf("credentials-%s.db", namespace)
+	}
+	dbPath := filepath.Join(dbDir, dbName)
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -176,9 +197,54 @@ func (cs *CredentialStore) DeleteCredentials(server, username string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete credentials: %w", err)
 	}
+	_, err = cs.db.Exec("DELETE FROM password_hashes WHERE server = ? AND username = ?", server, username)
+	if err != nil {
+		return fmt.Errorf("failed to delete password hash: %w", err)
+	}
 	return nil
 }
 
+// PasswordHash returns a bcrypt hash of the stored password of username on
+// server. The hash is generated once and kept, so labels built from it stay
+// the same across deploys, and is regenerated when the password changes.
+func (cs *CredentialStore) PasswordHash(server, username string) (string, error) {
+	creds, err := cs.GetCredentials(server, username)
+	if err != nil {
+		return "", err
+	}
+	if creds == nil {
+		return "", fmt.Errorf("no stored credentials for %s@%s", username, server)
+	}
+
+	var hash string
+	err = cs.db.QueryRow(
+		"SELECT hash FROM password_hashes WHERE server = ? AND username = ?",
+		server,
+		username,
+	).Scan(&hash)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get password hash: %w", err)
+	}
+	if err == nil && bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password)) == nil {
+		return hash, nil
+	}
+
+	generated, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	_, err = cs.db.Exec(
+		"INSERT OR REPLACE INTO password_hashes (server, username, hash) VALUES (?, ?, ?)",
+		server,
+		username,
+		string(generated),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to save password hash: %w", err)
+	}
+	return string(generated), nil
+}
+
 func (cs *CredentialStore) encrypt(data []byte) (string, error) {
 	nonce := make([]byte, cs.cipher.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
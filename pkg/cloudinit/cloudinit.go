@@ -0,0 +1,129 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// Options describes the node a cloud-init user-data document prepares
+type Options struct {
+	Role          types.ServerRole
+	AdminUser     string
+	PublicKeys    []string
+	DockerVersion string
+	LogDriver     string
+	LogOptions    map[string]string
+	// FirewallRules are ufw commands; the firewall is left alone when empty
+	FirewallRules []string
+	// Hostname names the node, which is how the swarm knows it after joining
+	Hostname string
+	// JoinToken and ManagerAddr make the node join the swarm on first boot
+	JoinToken     string
+	ManagerAddr   string
+	AdvertiseAddr string
+}
+
+type user struct {
+	Name              string   `yaml:"name"`
+	Groups            []string `yaml:"groups"`
+	Shell             string   `yaml:"shell"`
+	Sudo              string   `yaml:"sudo"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+}
+
+type writeFile struct {
+	Path        string `yaml:"path"`
+	Permissions string `yaml:"permissions"`
+	Content     string `yaml:"content"`
+}
+
+type userData struct {
+	Hostname      string      `yaml:"hostname,omitempty"`
+	Groups        []string    `yaml:"groups"`
+	Users         []user      `yaml:"users"`
+	PackageUpdate bool        `yaml:"package_update"`
+	Packages      []string    `yaml:"packages"`
+	WriteFiles    []writeFile `yaml:"write_files"`
+	RunCmd        []string    `yaml:"runcmd"`
+}
+
+// Render returns cloud-init user-data that creates the admin user, installs
+// the pinned Docker version and applies the role's packages, directories,
+// setup steps and firewall rules, optionally joining the swarm at the end.
+func Render(opts Options) ([]byte, error) {
+	def, ok := types.GetRoleDefinition(opts.Role)
+	if !ok {
+		return nil, fmt.Errorf("unknown server role: %s", opts.Role)
+	}
+	if opts.AdminUser == "" {
+		return nil, fmt.Errorf("admin user is required")
+	}
+
+	daemonConfig, err := json.MarshalIndent(map[string]interface{}{
+		"log-driver": opts.LogDriver,
+		"log-opts":   opts.LogOptions,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Docker daemon config: %w", err)
+	}
+
+	data := userData{
+		Hostname: opts.Hostname,
+		Groups:   []string{"docker"},
+		Users: []user{{
+			Name:              opts.AdminUser,
+			Groups:            []string{"sudo", "docker"},
+			Shell:             "/bin/bash",
+			Sudo:              "ALL=(ALL) NOPASSWD:ALL",
+			SSHAuthorizedKeys: opts.PublicKeys,
+		}},
+		PackageUpdate: true,
+		Packages:      append([]string{"ca-certificates", "curl", "ufw"}, def.Packages...),
+		WriteFiles: []writeFile{{
+			Path:        "/etc/docker/daemon.json",
+			Permissions: "0644",
+			Content:     string(daemonConfig) + "\n",
+		}},
+	}
+
+	install := "curl -fsSL https://get.docker.com | sh"
+	if opts.DockerVersion != "" {
+		install = fmt.Sprintf("curl -fsSL https://get.docker.com | VERSION=%s sh", opts.DockerVersion)
+	}
+	data.RunCmd = append(data.RunCmd, install, "systemctl enable --now docker")
+
+	for _, dir := range def.Directories {
+		data.RunCmd = append(data.RunCmd, "mkdir -p "+dir)
+	}
+	data.RunCmd = append(data.RunCmd, def.Setup...)
+
+	if len(opts.FirewallRules) > 0 {
+		data.RunCmd = append(data.RunCmd, opts.FirewallRules...)
+		data.RunCmd = append(data.RunCmd, "ufw --force enable")
+	}
+
+	if opts.JoinToken != "" {
+		join := "docker swarm join"
+		if opts.AdvertiseAddr != "" {
+			join += " --advertise-addr " + opts.AdvertiseAddr
+		}
+		data.RunCmd = append(data.RunCmd, fmt.Sprintf("%s --token %s %s:2377", join, opts.JoinToken, opts.ManagerAddr))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#cloud-config\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to encode user-data: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,85 @@
+package compose
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stringList is a YAML value given as a single string or a list of strings
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = []string{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+type fileRef struct {
+	File string `yaml:"file"`
+}
+
+// LocalFiles returns the local files a stack file refers to: the env_file of
+// each service and the file of each config and secret. Paths are relative
+// to the stack file, as docker stack deploy resolves them, and may not leave
+// its directory.
+func LocalFiles(data []byte) ([]string, error) {
+	var stack struct {
+		Services map[string]struct {
+			EnvFile stringList `yaml:"env_file"`
+		} `yaml:"services"`
+		Configs map[string]fileRef `yaml:"configs"`
+		Secrets map[string]fileRef `yaml:"secrets"`
+	}
+	if err := yaml.Unmarshal(data, &stack); err != nil {
+		return nil, fmt.Errorf("failed to parse stack file: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	add := func(owner, file string) error {
+		if file == "" {
+			return nil
+		}
+		clean := path.Clean(file)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("%s refers to %s, files must be inside the directory of the stack file", owner, file)
+		}
+		seen[clean] = true
+		return nil
+	}
+
+	for name, service := range stack.Services {
+		for _, file := range service.EnvFile {
+			if err := add("services."+name+".env_file", file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, ref := range stack.Configs {
+		if err := add("configs."+name+".file", ref.File); err != nil {
+			return nil, err
+		}
+	}
+	for name, ref := range stack.Secrets {
+		if err := add("secrets."+name+".file", ref.File); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
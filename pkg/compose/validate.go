@@ -0,0 +1,443 @@
+// Package compose validates stack files against the subset of the Compose
+// 3.8 format that docker stack deploy supports.
+package compose
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	memoryPattern = regexp.MustCompile(`^\d+(\.\d+)?([bkmgBKMG][bB]?)?$`)
+	versionRegexp = regexp.MustCompile(`^3(\.\d+)?$`)
+	portPattern   = regexp.MustCompile(`^(?:(?:\d+\.\d+\.\d+\.\d+|\[[0-9a-fA-F:]+\]):)?(?:(\d+(?:-\d+)?):)?(\d+(?:-\d+)?)(?:/(tcp|udp|sctp))?$`)
+)
+
+// Issue is a problem found in a stack file. Path is the dotted YAML path of
+// the offending key, such as services.api.deploy.resources.limits.cpus.
+type Issue struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.Path, i.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", i.Line, i.Path, i.Message)
+}
+
+// ValidationError is returned when a stack file has issues
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = "  " + issue.String()
+	}
+	return fmt.Sprintf("invalid stack file:\n%s", strings.Join(lines, "\n"))
+}
+
+// Keys swarm ignores when deploying a stack, with the reason shown to the user
+var ignoredServiceKeys = map[string]string{
+	"build":          "images must be built and pushed before deploying",
+	"depends_on":     "swarm does not order service start-up",
+	"container_name": "swarm names containers itself",
+	"restart":        "use deploy.restart_policy",
+	"links":          "use networks",
+	"external_links": "use networks",
+	"network_mode":   "use networks",
+	"cgroup_parent":  "not supported by swarm services",
+	"devices":        "not supported by swarm services",
+	"userns_mode":    "not supported by swarm services",
+	"security_opt":   "not supported by swarm services",
+	"mem_limit":      "use deploy.resources.limits.memory",
+	"cpus":           "use deploy.resources.limits.cpus",
+}
+
+var (
+	topLevelKeys = keySet("version", "services", "networks", "volumes", "configs", "secrets")
+	serviceKeys  = keySet("cap_add", "cap_drop", "command", "configs", "credential_spec", "deploy",
+		"dns", "dns_search", "domainname", "entrypoint", "env_file", "environment", "expose",
+		"extra_hosts", "healthcheck", "hostname", "image", "init", "isolation", "labels", "logging",
+		"networks", "ports", "read_only", "secrets", "stdin_open", "stop_grace_period", "stop_signal",
+		"sysctls", "tmpfs", "tty", "ulimits", "user", "volumes", "working_dir")
+	deployKeys = keySet("endpoint_mode", "labels", "mode", "placement", "replicas", "resources",
+		"restart_policy", "rollback_config", "update_config")
+	placementKeys     = keySet("constraints", "preferences", "max_replicas_per_node")
+	resourcesKeys     = keySet("limits", "reservations")
+	limitKeys         = keySet("cpus", "memory", "pids", "generic_resources")
+	restartPolicyKeys = keySet("condition", "delay", "max_attempts", "window")
+	updateConfigKeys  = keySet("parallelism", "delay", "failure_action", "monitor", "max_failure_ratio", "order")
+	healthcheckKeys   = keySet("test", "interval", "timeout", "retries", "start_period", "disable")
+	portKeys          = keySet("target", "published", "protocol", "mode")
+)
+
+func keySet(keys ...string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// Validate parses a stack file and checks it. Parse errors are returned as
+// an error; everything else is reported as issues sorted by line.
+func Validate(data []byte) ([]Issue, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse stack file: %w", err)
+	}
+
+	v := &validator{published: make(map[string]string)}
+	if len(doc.Content) == 0 {
+		v.add("", nil, "stack file is empty")
+		return v.issues, nil
+	}
+	v.checkRoot(doc.Content[0])
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues, nil
+}
+
+// Check validates a stack file and returns a ValidationError listing every
+// issue, or nil when it is valid
+func Check(data []byte) error {
+	issues, err := Validate(data)
+	if err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		return &ValidationError{Issues: issues}
+	}
+	return nil
+}
+
+type validator struct {
+	issues []Issue
+	// published maps port/protocol to the service publishing it
+	published map[string]string
+	networks  map[string]bool
+	volumes   map[string]bool
+	configs   map[string]bool
+	secrets   map[string]bool
+}
+
+func (v *validator) add(path string, node *yaml.Node, format string, args ...interface{}) {
+	issue := Issue{Path: path, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		issue.Line = node.Line
+	}
+	v.issues = append(v.issues, issue)
+}
+
+// entries returns the key and value nodes of a mapping, reporting an issue
+// when node is not a mapping
+func (v *validator) entries(path string, node *yaml.Node) [][2]*yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		if node.Tag != "!!null" {
+			v.add(path, node, "expected a mapping")
+		}
+		return nil
+	}
+	pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	return pairs
+}
+
+// checkKeys reports keys of a mapping that are not in allowed and returns
+// its entries
+func (v *validator) checkKeys(path string, node *yaml.Node, allowed map[string]bool) [][2]*yaml.Node {
+	pairs := v.entries(path, node)
+	for _, pair := range pairs {
+		key := pair[0].Value
+		if !allowed[key] && !strings.HasPrefix(key, "x-") {
+			v.add(join(path, key), pair[0], "unknown key")
+		}
+	}
+	return pairs
+}
+
+func (v *validator) checkRoot(root *yaml.Node) {
+	var services *yaml.Node
+	for _, pair := range v.checkKeys("", root, topLevelKeys) {
+		key, value := pair[0].Value, pair[1]
+		switch key {
+		case "version":
+			if !versionRegexp.MatchString(value.Value) {
+				v.add(key, value, "version %q is not supported, swarm stacks use version 3.x", value.Value)
+			}
+		case "services":
+			services = value
+		case "networks":
+			v.networks = v.names(key, value)
+		case "volumes":
+			v.volumes = v.names(key, value)
+		case "configs":
+			v.configs = v.names(key, value)
+		case "secrets":
+			v.secrets = v.names(key, value)
+		}
+	}
+
+	if services == nil {
+		v.add("services", root, "stack file has no services")
+		return
+	}
+	for _, pair := range v.entries("services", services) {
+		v.checkService(join("services", pair[0].Value), pair[0].Value, pair[1])
+	}
+}
+
+func (v *validator) names(path string, node *yaml.Node) map[string]bool {
+	names := make(map[string]bool)
+	for _, pair := range v.entries(path, node) {
+		names[pair[0].Value] = true
+	}
+	return names
+}
+
+func (v *validator) checkService(path, name string, node *yaml.Node) {
+	hasImage := false
+	for _, pair := range v.entries(path, node) {
+		key, value := pair[0].Value, pair[1]
+		keyPath := join(path, key)
+
+		if reason, ok := ignoredServiceKeys[key]; ok {
+			v.add(keyPath, pair[0], "ignored by docker stack deploy, %s", reason)
+			continue
+		}
+		if !serviceKeys[key] && !strings.HasPrefix(key, "x-") {
+			v.add(keyPath, pair[0], "unknown key")
+			continue
+		}
+
+		switch key {
+		case "image":
+			hasImage = value.Value != ""
+		case "deploy":
+			v.checkDeploy(keyPath, value)
+		case "ports":
+			v.checkPorts(keyPath, name, value)
+		case "healthcheck":
+			v.checkDurations(keyPath, v.checkKeys(keyPath, value, healthcheckKeys), "interval", "timeout", "start_period")
+		case "stop_grace_period":
+			v.checkDuration(keyPath, value)
+		case "networks":
+			v.checkReferences(keyPath, value, v.networks, "network")
+		case "configs":
+			v.checkReferences(keyPath, value, v.configs, "config")
+		case "secrets":
+			v.checkReferences(keyPath, value, v.secrets, "secret")
+		case "volumes":
+			v.checkVolumes(keyPath, value)
+		}
+	}
+	if !hasImage {
+		v.add(path, node, "service has no image")
+	}
+}
+
+func (v *validator) checkDeploy(path string, node *yaml.Node) {
+	for _, pair := range v.checkKeys(path, node, deployKeys) {
+		key, value := pair[0].Value, pair[1]
+		keyPath := join(path, key)
+		switch key {
+		case "mode":
+			v.checkEnum(keyPath, value, "replicated", "global")
+		case "replicas":
+			if n, err := strconv.Atoi(value.Value); err != nil || n < 0 {
+				v.add(keyPath, value, "replicas must be a non-negative integer")
+			}
+		case "placement":
+			v.checkKeys(keyPath, value, placementKeys)
+		case "resources":
+			for _, res := range v.checkKeys(keyPath, value, resourcesKeys) {
+				v.checkResources(join(keyPath, res[0].Value), res[1])
+			}
+		case "restart_policy":
+			pairs := v.checkKeys(keyPath, value, restartPolicyKeys)
+			v.checkDurations(keyPath, pairs, "delay", "window")
+			for _, p := range pairs {
+				if p[0].Value == "condition" {
+					v.checkEnum(join(keyPath, "condition"), p[1], "none", "on-failure", "any")
+				}
+			}
+		case "update_config", "rollback_config":
+			pairs := v.checkKeys(keyPath, value, updateConfigKeys)
+			v.checkDurations(keyPath, pairs, "delay", "monitor")
+			for _, p := range pairs {
+				switch p[0].Value {
+				case "failure_action":
+					v.checkEnum(join(keyPath, p[0].Value), p[1], "continue", "rollback", "pause")
+				case "order":
+					v.checkEnum(join(keyPath, p[0].Value), p[1], "stop-first", "start-first")
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) checkEnum(path string, node *yaml.Node, values ...string) {
+	for _, value := range values {
+		if node.Value == value {
+			return
+		}
+	}
+	v.add(path, node, "%q is not one of %s", node.Value, strings.Join(values, ", "))
+}
+
+func (v *validator) checkResources(path string, node *yaml.Node) {
+	for _, pair := range v.checkKeys(path, node, limitKeys) {
+		key, value := pair[0].Value, pair[1]
+		switch key {
+		case "cpus":
+			if cpus, err := strconv.ParseFloat(value.Value, 64); err != nil || cpus <= 0 {
+				v.add(join(path, key), value, "malformed cpus %q, expected a positive number such as '0.5'", value.Value)
+			}
+		case "memory":
+			if !memoryPattern.MatchString(value.Value) {
+				v.add(join(path, key), value, "malformed memory %q, expected a size such as 512M or 1G", value.Value)
+			}
+		}
+	}
+}
+
+func (v *validator) checkDurations(path string, pairs [][2]*yaml.Node, keys ...string) {
+	for _, pair := range pairs {
+		for _, key := range keys {
+			if pair[0].Value == key {
+				v.checkDuration(join(path, key), pair[1])
+			}
+		}
+	}
+}
+
+func (v *validator) checkDuration(path string, node *yaml.Node) {
+	if _, err := time.ParseDuration(node.Value); err != nil {
+		v.add(path, node, "malformed duration %q, expected a value such as 10s or 1m30s", node.Value)
+	}
+}
+
+func (v *validator) checkPorts(path, service string, node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.add(path, node, "expected a list")
+		return
+	}
+	for i, port := range node.Content {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		published, protocol := "", "tcp"
+
+		if port.Kind == yaml.MappingNode {
+			for _, pair := range v.checkKeys(itemPath, port, portKeys) {
+				switch pair[0].Value {
+				case "published":
+					published = pair[1].Value
+				case "protocol":
+					protocol = pair[1].Value
+				}
+			}
+		} else {
+			m := portPattern.FindStringSubmatch(port.Value)
+			if m == nil {
+				v.add(itemPath, port, "malformed port %q, expected [published:]target[/protocol]", port.Value)
+				continue
+			}
+			published = m[1]
+			if m[3] != "" {
+				protocol = m[3]
+			}
+		}
+
+		if published == "" {
+			continue
+		}
+		key := published + "/" + protocol
+		if first, ok := v.published[key]; ok {
+			v.add(itemPath, port, "port %s is already published by %s", key, first)
+			continue
+		}
+		v.published[key] = service
+	}
+}
+
+// checkReferences reports networks, configs and secrets that a service uses
+// but the stack does not declare
+func (v *validator) checkReferences(path string, node *yaml.Node, declared map[string]bool, kind string) {
+	var refs []*yaml.Node
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.MappingNode {
+				for _, pair := range v.entries(path, item) {
+					if pair[0].Value == "source" {
+						refs = append(refs, pair[1])
+					}
+				}
+				continue
+			}
+			refs = append(refs, item)
+		}
+	case yaml.MappingNode:
+		for _, pair := range v.entries(path, node) {
+			refs = append(refs, pair[0])
+		}
+	}
+
+	for _, ref := range refs {
+		// The default network always exists
+		if kind == "network" && ref.Value == "default" {
+			continue
+		}
+		if !declared[ref.Value] {
+			v.add(path, ref, "%s %s is not declared at the top level", kind, ref.Value)
+		}
+	}
+}
+
+func (v *validator) checkVolumes(path string, node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.add(path, node, "expected a list")
+		return
+	}
+	for i, item := range node.Content {
+		source := ""
+		if item.Kind == yaml.MappingNode {
+			for _, pair := range v.entries(path, item) {
+				if pair[0].Value == "source" {
+					source = pair[1].Value
+				}
+			}
+		} else if parts := strings.SplitN(item.Value, ":", 2); len(parts) == 2 {
+			source = parts[0]
+		}
+
+		// Bind mounts are paths; anything else is a named volume
+		if source == "" || strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") {
+			continue
+		}
+		if !v.volumes[source] {
+			v.add(fmt.Sprintf("%s[%d]", path, i), item, "volume %s is not declared at the top level", source)
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
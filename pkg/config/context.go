@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var contextName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ContextPath returns the configuration file of a named context
+func ContextPath(name string) (string, error) {
+	if !contextName.MatchString(name) {
+		return "", fmt.Errorf("invalid context name %q", name)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "contexts", name+".yaml"), nil
+}
+
+// ContextExists reports whether a named context has been created
+func ContextExists(name string) bool {
+	path, err := ContextPath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// CurrentContext returns the active context, or an empty string if none
+func CurrentContext() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "context"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read current context: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// UseContext makes name the active context
+func UseContext(name string) error {
+	if !ContextExists(name) {
+		return fmt.Errorf("context %s does not exist", name)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "context"), []byte(name+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write current context: %w", err)
+	}
+	return nil
+}
+
+// ListContexts returns the names of all contexts in sorted order
+func ListContexts() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "contexts", "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contexts: %w", err)
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(match), ".yaml"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/templates"
+)
+
+// Defaults returns the built-in defaults with the overrides of cfg applied.
+// Overrides are decoded over the built-in values, so a context only needs to
+// list the settings it changes.
+func Defaults(cfg *types.InfraConfig) (types.Defaults, error) {
+	var defaults types.Defaults
+	if err := yaml.Unmarshal(templates.DefaultConfig, &defaults); err != nil {
+		return defaults, fmt.Errorf("failed to parse built-in defaults: %w", err)
+	}
+	if len(cfg.Defaults) == 0 {
+		return defaults, nil
+	}
+
+	overrides, err := yaml.Marshal(cfg.Defaults)
+	if err != nil {
+		return defaults, fmt.Errorf("failed to encode defaults: %w", err)
+	}
+	if err := yaml.Unmarshal(overrides, &defaults); err != nil {
+		return defaults, fmt.Errorf("failed to parse defaults: %w", err)
+	}
+	return defaults, nil
+}
@@ -0,0 +1,334 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cploutarchou/swarmforge/pkg/traefik"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+var (
+	domainPattern   = regexp.MustCompile(`^(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)(\.(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?))+$`)
+	hostnamePattern = regexp.MustCompile(`^(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)(\.(?i:[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?))*$`)
+	portPattern     = regexp.MustCompile(`^\d{1,5}(:\d{1,5})?(/(tcp|udp))?$`)
+	yamlErrorLine   = regexp.MustCompile(`^line (\d+): (.*)$`)
+)
+
+// ValidHostname reports whether name is an RFC 1123 host name
+func ValidHostname(name string) bool {
+	return len(name) <= 253 && hostnamePattern.MatchString(name)
+}
+
+// Issue is a problem found while validating a configuration file
+type Issue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Message)
+}
+
+// Validate checks a configuration file for schema and semantic errors. When
+// credentials is not nil, credential references of nodes are checked against
+// it as well.
+func Validate(path string, credentials []string) ([]Issue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	v := &validator{file: path}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		v.yamlError(err)
+		return v.issues, nil
+	}
+	if len(root.Content) == 0 {
+		v.add(nil, "configuration is empty")
+		return v.issues, nil
+	}
+	v.root = root.Content[0]
+
+	// Unknown keys and type mismatches
+	cfg := &types.InfraConfig{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		v.yamlError(err)
+	}
+	if _, err := Defaults(cfg); err != nil {
+		v.add(v.find("defaults"), "%s", err)
+	}
+	v.checkRoles(cfg)
+
+	v.checkDomains(cfg)
+	v.checkInventory(cfg, credentials)
+	v.checkTraefik(cfg)
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues, nil
+}
+
+type validator struct {
+	file   string
+	root   *yaml.Node
+	issues []Issue
+	// roles are the built-in roles and those declared in the file
+	roles []types.ServerRole
+}
+
+func (v *validator) add(node *yaml.Node, format string, args ...interface{}) {
+	issue := Issue{File: v.file, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		issue.Line, issue.Column = node.Line, node.Column
+	}
+	v.issues = append(v.issues, issue)
+}
+
+func (v *validator) yamlError(err error) {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		msg := strings.TrimPrefix(err.Error(), "yaml: ")
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			v.issues = append(v.issues, Issue{File: v.file, Line: line, Column: 1, Message: m[2]})
+			return
+		}
+		v.add(nil, "%s", msg)
+		return
+	}
+
+	for _, e := range typeErr.Errors {
+		if m := yamlErrorLine.FindStringSubmatch(e); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			v.issues = append(v.issues, Issue{File: v.file, Line: line, Column: 1, Message: m[2]})
+			continue
+		}
+		v.add(nil, "%s", e)
+	}
+}
+
+// find returns the YAML node at a path of mapping keys and sequence indexes
+func (v *validator) find(path ...interface{}) *yaml.Node {
+	node := v.root
+	for _, elem := range path {
+		if node == nil {
+			return nil
+		}
+		switch key := elem.(type) {
+		case string:
+			if node.Kind != yaml.MappingNode {
+				return nil
+			}
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					break
+				}
+			}
+			node = next
+		case int:
+			if node.Kind != yaml.SequenceNode || key >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[key]
+		}
+	}
+	return node
+}
+
+// at returns the node at path or the closest existing parent
+func (v *validator) at(path ...interface{}) *yaml.Node {
+	for i := len(path); i >= 0; i-- {
+		if node := v.find(path[:i]...); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+func (v *validator) checkDomains(cfg *types.InfraConfig) {
+	domains := map[string]string{
+		"base":     cfg.Domain.Base,
+		"gitlab":   cfg.Domain.Gitlab,
+		"registry": cfg.Domain.Registry,
+		"monitor":  cfg.Domain.Monitor,
+		"apps":     cfg.Domain.Apps,
+	}
+	for key, value := range domains {
+		if value != "" && !domainPattern.MatchString(value) {
+			v.add(v.at("domain", key), "malformed domain %q", value)
+		}
+	}
+
+	if cfg.Domain.Email != "" && !strings.Contains(cfg.Domain.Email, "@") {
+		v.add(v.at("domain", "email"), "malformed email %q", cfg.Domain.Email)
+	}
+}
+
+func (v *validator) checkInventory(cfg *types.InfraConfig, credentials []string) {
+	known := make(map[string]bool)
+	for _, cred := range credentials {
+		known[cred] = true
+	}
+
+	names := make(map[string]int)
+	addresses := make(map[string]string)
+	for i, node := range cfg.Nodes {
+		if node.Name == "" {
+			v.add(v.at("nodes", i), "node has no name")
+		} else if line, ok := names[node.Name]; ok {
+			v.add(v.at("nodes", i, "name"), "duplicate node name %q, first defined on line %d", node.Name, line)
+		} else {
+			names[node.Name] = v.at("nodes", i, "name").Line
+		}
+
+		v.checkAddress(node.Address, addresses, node.Name, "nodes", i, "address")
+		v.checkRole(node.Role, "nodes", i, "role")
+
+		if node.Credential != "" && credentials != nil && !known[node.Credential] {
+			v.add(v.at("nodes", i, "credential"), "credential %q does not exist in the credential store", node.Credential)
+		}
+	}
+
+	servers := map[string]types.ServerConfig{
+		"manager": cfg.Servers.Manager,
+		"gitlab":  cfg.Servers.Gitlab,
+		"monitor": cfg.Servers.Monitor,
+		"apps":    cfg.Servers.Apps,
+	}
+	for _, slot := range []string{"manager", "gitlab", "monitor", "apps"} {
+		server := servers[slot]
+		if server.IP == "" {
+			continue
+		}
+		v.checkAddress(server.IP, addresses, slot, "servers", slot, "ip")
+		if server.Role != "" {
+			v.checkRole(server.Role, "servers", slot, "role")
+		}
+	}
+
+	managers := len(cfg.Managers())
+	switch {
+	case managers == 0:
+		v.add(v.at("nodes"), "inventory has no manager node")
+	case managers%2 == 0:
+		v.add(v.at("nodes"), "inventory has %d managers, use an odd number to keep raft quorum", managers)
+	}
+}
+
+func (v *validator) checkAddress(address string, seen map[string]string, owner string, path ...interface{}) {
+	node := v.at(path...)
+	if address == "" {
+		v.add(node, "%s has no address", owner)
+		return
+	}
+
+	if net.ParseIP(address) == nil {
+		if strings.Trim(address, "0123456789.") == "" || strings.Contains(address, ":") || !hostnamePattern.MatchString(address) {
+			v.add(node, "malformed address %q", address)
+			return
+		}
+	}
+
+	if first, ok := seen[address]; ok {
+		v.add(node, "address %s is used by both %s and %s", address, first, owner)
+		return
+	}
+	seen[address] = owner
+}
+
+func (v *validator) checkRoles(cfg *types.InfraConfig) {
+	for name, def := range cfg.Roles {
+		if types.IsBuiltinRole(types.ServerRole(name)) {
+			v.add(v.at("roles", name), "role %s is built in and cannot be redefined", name)
+			continue
+		}
+		for i, port := range def.Ports {
+			if !portPattern.MatchString(port) {
+				v.add(v.at("roles", name, "ports", i), "malformed port %q, expected <port>[/tcp|/udp]", port)
+			}
+		}
+	}
+
+	// Nodes may use the roles declared in this file, independent of the
+	// roles of the active configuration
+	var custom []types.ServerRole
+	for name := range cfg.Roles {
+		if !types.IsBuiltinRole(types.ServerRole(name)) {
+			custom = append(custom, types.ServerRole(name))
+		}
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i] < custom[j] })
+	v.roles = append(types.BuiltinRoles(), custom...)
+}
+
+func (v *validator) checkRole(role types.ServerRole, path ...interface{}) {
+	for _, valid := range v.roles {
+		if role == valid {
+			return
+		}
+	}
+	v.add(v.at(path...), "unknown role %q, valid roles are %v", role, v.roles)
+}
+
+func (v *validator) checkTraefik(cfg *types.InfraConfig) {
+	catalog := cfg.Traefik
+	for name, m := range catalog.Middlewares {
+		if _, err := traefik.Kind(m); err != nil {
+			v.add(v.at("traefik", "middlewares", name), "middleware %s: %s", name, err)
+		}
+		for i, ref := range m.BasicAuth {
+			if server, user, ok := strings.Cut(ref, "/"); !ok || server == "" || user == "" {
+				v.add(v.at("traefik", "middlewares", name, "basic_auth", i), "malformed basic auth user %q, expected server/username", ref)
+			}
+		}
+		if _, ok := catalog.Chains[name]; ok {
+			v.add(v.at("traefik", "chains", name), "%s is both a middleware and a chain", name)
+		}
+	}
+
+	ports := make(map[string]string)
+	for _, name := range traefik.EntrypointNames(catalog) {
+		ep := catalog.Entrypoints[name]
+		if err := traefik.CheckEntrypoint(name, ep); err != nil {
+			v.add(v.at("traefik", "entrypoints", name), "%s", err)
+			continue
+		}
+		key := fmt.Sprintf("%d/%s", ep.Port, traefik.EntrypointProtocol(ep))
+		if other, ok := ports[key]; ok {
+			v.add(v.at("traefik", "entrypoints", name, "port"), "entrypoint %s uses port %s of entrypoint %s", name, key, other)
+		}
+		ports[key] = name
+	}
+
+	for name, members := range catalog.Chains {
+		for i, member := range members {
+			_, isMiddleware := catalog.Middlewares[member]
+			_, isChain := catalog.Chains[member]
+			if !isMiddleware && !isChain {
+				v.add(v.at("traefik", "chains", name, i), "chain %s uses unknown middleware %s", name, member)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// Export formats supported by Export
+const (
+	FormatAnsible   = "ansible"
+	FormatSSHConfig = "ssh-config"
+	FormatJSON      = "json"
+)
+
+var invalidVarChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Formats returns the supported export formats
+func Formats() []string {
+	return []string{FormatAnsible, FormatSSHConfig, FormatJSON}
+}
+
+// Export renders the inventory of cfg in the given format
+func Export(cfg *types.InfraConfig, format string) ([]byte, error) {
+	switch format {
+	case FormatAnsible:
+		return Ansible(cfg)
+	case FormatSSHConfig:
+		return SSHConfig(cfg), nil
+	case FormatJSON:
+		return JSON(cfg)
+	default:
+		return nil, fmt.Errorf("unknown export format %q, valid formats are %v", format, Formats())
+	}
+}
+
+// Ansible renders a YAML Ansible inventory. Every node is a host of the all
+// group with its labels as label_* host variables, and each role and group
+// becomes a child group.
+func Ansible(cfg *types.InfraConfig) ([]byte, error) {
+	type group struct {
+		Hosts map[string]struct{} `yaml:"hosts"`
+	}
+	type all struct {
+		Hosts    map[string]map[string]string `yaml:"hosts"`
+		Children map[string]group             `yaml:"children,omitempty"`
+	}
+
+	inv := all{
+		Hosts:    make(map[string]map[string]string),
+		Children: make(map[string]group),
+	}
+	for _, node := range cfg.Inventory() {
+		vars := map[string]string{
+			"ansible_host": node.Address,
+			"infra_role":   node.Role.String(),
+		}
+		if user := nodeUser(cfg, node); user != "" {
+			vars["ansible_user"] = user
+		}
+		if jump := jumpHost(cfg, node, false); jump != "" {
+			vars["ansible_ssh_common_args"] = fmt.Sprintf("-o ProxyJump=%s", jump)
+		}
+		for key, value := range node.Labels {
+			vars["label_"+invalidVarChars.ReplaceAllString(key, "_")] = value
+		}
+		inv.Hosts[node.Name] = vars
+
+		for _, name := range append([]string{node.Role.String()}, node.Groups...) {
+			// Ansible group names may not contain dashes or dots
+			name = invalidVarChars.ReplaceAllString(name, "_")
+			g, ok := inv.Children[name]
+			if !ok {
+				g = group{Hosts: make(map[string]struct{})}
+				inv.Children[name] = g
+			}
+			g.Hosts[node.Name] = struct{}{}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]all{"all": inv}); err != nil {
+		return nil, fmt.Errorf("failed to encode Ansible inventory: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SSHConfig renders an ~/.ssh/config snippet with one Host entry per node
+func SSHConfig(cfg *types.InfraConfig) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by infra inventory export\n")
+
+	for _, node := range cfg.Inventory() {
+		fmt.Fprintf(&buf, "\nHost %s\n", node.Name)
+		fmt.Fprintf(&buf, "  HostName %s\n", node.Address)
+		if user := nodeUser(cfg, node); user != "" {
+			fmt.Fprintf(&buf, "  User %s\n", user)
+		}
+		if jump := jumpHost(cfg, node, true); jump != "" {
+			fmt.Fprintf(&buf, "  ProxyJump %s\n", jump)
+		}
+		if cfg.Auth.SSHKey != "" {
+			fmt.Fprintf(&buf, "  IdentityFile %s\n", cfg.Auth.SSHKey)
+		}
+	}
+	return buf.Bytes()
+}
+
+// JSON renders the inventory nodes as a JSON array
+func JSON(cfg *types.InfraConfig) ([]byte, error) {
+	nodes := cfg.Inventory()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	data, err := json.MarshalIndent(nodes, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+func nodeUser(cfg *types.InfraConfig, node types.NodeConfig) string {
+	if node.User != "" {
+		return node.User
+	}
+	return cfg.Auth.Username
+}
+
+// jumpHost returns the jump host of a node. Jump hosts that are inventory
+// nodes are referenced by name when byName is set, since the SSH config has a
+// Host entry for them, and as user@address otherwise.
+func jumpHost(cfg *types.InfraConfig, node types.NodeConfig, byName bool) string {
+	if node.Jump == "" {
+		return ""
+	}
+	jump, ok := cfg.FindNode(node.Jump)
+	if !ok || byName {
+		return node.Jump
+	}
+	if user := nodeUser(cfg, jump); user != "" {
+		return fmt.Sprintf("%s@%s", user, jump.Address)
+	}
+	return jump.Address
+}
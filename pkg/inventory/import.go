@@ -0,0 +1,141 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// Imported is a node read from a live swarm. Review lists what did not map
+// cleanly onto the inventory and needs a human decision.
+type Imported struct {
+	Node         types.NodeConfig
+	Availability string
+	Engine       string
+	Review       []string
+}
+
+// FromSwarm maps inspected swarm nodes to inventory nodes. The role label is
+// mapped back to a server role; nodes without one fall back to their swarm
+// role and are flagged, as are labels that disagree with the role.
+func FromSwarm(nodes []swarm.Node) []Imported {
+	imported := make([]Imported, 0, len(nodes))
+	for _, n := range nodes {
+		item := Imported{
+			Availability: n.Spec.Availability,
+			Engine:       n.Description.Engine.EngineVersion,
+		}
+
+		labels := make(map[string]string, len(n.Spec.Labels))
+		for key, value := range n.Spec.Labels {
+			labels[key] = value
+		}
+
+		role := types.ServerRole(labels["role"])
+		labeled := role != ""
+		switch {
+		case role == "" && n.Spec.Role == "manager":
+			role = types.ManagerServer
+			item.Review = append(item.Review, "no role label, assumed manager from swarm role")
+		case role == "":
+			role = types.AppsServer
+			item.Review = append(item.Review, "no role label, assumed apps")
+		case !types.IsValidServerRole(role.String()):
+			item.Review = append(item.Review, fmt.Sprintf("unknown role %q, declare it under roles", role))
+		}
+
+		if role == types.ManagerServer && n.Spec.Role != "manager" {
+			item.Review = append(item.Review, "labeled manager but is a swarm worker")
+		}
+		if role != types.ManagerServer && n.Spec.Role == "manager" {
+			item.Review = append(item.Review, fmt.Sprintf("labeled %s but is a swarm manager", role))
+		}
+
+		// Labels implied by the role are dropped; anything that disagrees
+		// with the role definition is flagged
+		if labeled {
+			for key, want := range types.GetServerLabels(role) {
+				got, ok := labels[key]
+				switch {
+				case !ok:
+					item.Review = append(item.Review, fmt.Sprintf("missing label %s=%s", key, want))
+				case got != want:
+					item.Review = append(item.Review, fmt.Sprintf("label %s=%s, role %s expects %s", key, got, role, want))
+				default:
+					delete(labels, key)
+				}
+			}
+		}
+		if len(labels) == 0 {
+			labels = nil
+		}
+
+		item.Node = types.NodeConfig{
+			Name:    n.Description.Hostname,
+			Address: n.Address(),
+			Role:    role,
+			Labels:  labels,
+		}
+		sort.Strings(item.Review)
+		imported = append(imported, item)
+	}
+
+	sort.Slice(imported, func(i, j int) bool {
+		return imported[i].Node.Name < imported[j].Node.Name
+	})
+	return imported
+}
+
+// Write saves imported nodes as an inventory file. Engine version and
+// availability are recorded as comments and review notes are marked with
+// REVIEW so they are easy to find.
+func Write(path string, imported []Imported) error {
+	cfg := types.InfraConfig{}
+	for _, item := range imported {
+		cfg.Nodes = append(cfg.Nodes, item.Node)
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(&cfg); err != nil {
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	doc.HeadComment = "Imported from a live swarm"
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "nodes" {
+			continue
+		}
+		for j, node := range doc.Content[i+1].Content {
+			item := imported[j]
+			comments := []string{fmt.Sprintf("engine %s, availability %s", item.Engine, item.Availability)}
+			for _, note := range item.Review {
+				comments = append(comments, "REVIEW: "+note)
+			}
+			node.HeadComment = strings.Join(comments, "\n")
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode inventory: %w", err)
+	}
+	enc.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write inventory: %w", err)
+	}
+	return nil
+}
@@ -1,7 +1,13 @@
 package migration
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/setup"
 	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
 )
 
 // CreateBackup creates a backup of the current state
@@ -10,10 +16,66 @@ func CreateBackup(serverIP, username, password string) error {
 	return nil
 }
 
-// MigrateNode migrates a node to a new role
-func MigrateNode(serverIP, username, password string, role types.ServerRole) error {
-	// TODO: Implement node migration
-	return nil
+// MigrateNode migrates a node to a new role. The labels of the old role are
+// replaced with those of the new one through the manager, the node is
+// promoted or demoted as its manager status requires and the new role's
+// setup is run on it. The manager is reached with its own credentials.
+func MigrateNode(managerIP, managerUser, managerPassword, serverIP, username, password string, role types.ServerRole) error {
+	nodeID, err := utils.ExecuteRemoteCommand(serverIP, username, password, "docker info --format '{{.Swarm.NodeID}}'")
+	if err != nil {
+		return fmt.Errorf("failed to get node ID: %w", err)
+	}
+	nodeID = strings.TrimSpace(nodeID)
+	if nodeID == "" {
+		return fmt.Errorf("node %s is not part of a swarm", serverIP)
+	}
+
+	output, err := utils.ExecuteRemoteCommand(managerIP, managerUser, managerPassword,
+		fmt.Sprintf("docker node inspect --format '{{json .}}' %s", nodeID))
+	if err != nil {
+		return fmt.Errorf("failed to inspect node: %w", err)
+	}
+	var node struct {
+		Spec struct {
+			Labels map[string]string
+		}
+		// ManagerStatus is only set on managers
+		ManagerStatus *struct{}
+	}
+	if err := json.Unmarshal([]byte(output), &node); err != nil {
+		return fmt.Errorf("failed to parse node: %w", err)
+	}
+	current := node.Spec.Labels
+	oldRole := types.ServerRole(current["role"])
+
+	var args []string
+	newLabels := types.GetServerLabels(role)
+	for key := range types.GetServerLabels(oldRole) {
+		if _, ok := newLabels[key]; !ok && current[key] != "" {
+			args = append(args, "--label-rm "+key)
+		}
+	}
+	for key, value := range newLabels {
+		args = append(args, fmt.Sprintf("--label-add %s=%s", key, value))
+	}
+
+	updateCmd := fmt.Sprintf("docker node update %s %s", strings.Join(args, " "), nodeID)
+	if _, err := utils.ExecuteRemoteCommand(managerIP, managerUser, managerPassword, updateCmd); err != nil {
+		return fmt.Errorf("failed to update node labels: %w", err)
+	}
+
+	isManager := node.ManagerStatus != nil
+	switch {
+	case role == types.ManagerServer && !isManager:
+		_, err = utils.ExecuteRemoteCommand(managerIP, managerUser, managerPassword, "docker node promote "+nodeID)
+	case role != types.ManagerServer && isManager:
+		_, err = utils.ExecuteRemoteCommand(managerIP, managerUser, managerPassword, "docker node demote "+nodeID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change node manager status: %w", err)
+	}
+
+	return setup.ApplyRole(serverIP, username, password, role)
 }
 
 // SetupManager sets up a new manager node
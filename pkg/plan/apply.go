@@ -0,0 +1,284 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cploutarchou/swarmforge/pkg/release"
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// StackDeployer deploys the named stack of the desired state
+type StackDeployer func(name string) error
+
+// Applier carries out plans on the swarm managed from IP
+type Applier struct {
+	IP       string
+	Username string
+	Password string
+	// DeployStack deploys stacks, which are rendered and uploaded like
+	// deploy stack does
+	DeployStack StackDeployer
+	// Timeout is how long added and changed services get to become
+	// healthy, zero skips waiting
+	Timeout time.Duration
+	// Log reports each step
+	Log func(format string, args ...interface{})
+}
+
+// Apply carries out plan in order. With prune set, older versions of the
+// declared secrets are removed once no service uses them.
+func (a *Applier) Apply(plan Plan, desired Desired, prune bool) error {
+	for _, action := range plan.Actions {
+		a.log("%s %s %s", action.Op, action.Kind, action.Name)
+		if err := a.apply(action, desired); err != nil {
+			return fmt.Errorf("failed to %s %s %s: %w", action.Op, action.Kind, action.Name, err)
+		}
+	}
+
+	if prune && len(desired.State.Secrets) > 0 {
+		var bases, keep []string
+		for name := range desired.State.Secrets {
+			bases = append(bases, name)
+			keep = append(keep, desired.secretVersion(name))
+		}
+		pruned, err := secrets.Prune(a.IP, a.Username, a.Password, secrets.Secret, bases, keep)
+		for _, name := range pruned {
+			a.log("pruned secret %s", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Applier) apply(action Action, desired Desired) error {
+	switch action.Kind {
+	case Network:
+		return a.applyNetwork(action, desired)
+	case Secret:
+		return a.applySecret(action, desired)
+	case Node:
+		return a.applyNode(action)
+	case Service:
+		return a.applyService(action, desired)
+	case Stack:
+		return a.applyStack(action, desired)
+	}
+	return fmt.Errorf("unknown kind %s", action.Kind)
+}
+
+func (a *Applier) applyNetwork(action Action, desired Desired) error {
+	if action.Op == Remove || action.Op == Replace {
+		if err := a.run("docker network rm " + utils.ShellQuote(action.Name)); err != nil {
+			return err
+		}
+		if action.Op == Remove {
+			return nil
+		}
+	}
+
+	spec := desired.State.Networks[action.Name]
+	driver := spec.Driver
+	if driver == "" {
+		driver = "overlay"
+	}
+	args := []string{"docker network create", "--driver " + utils.ShellQuote(driver), "--label " + ManagedLabel + "=true"}
+	if spec.Attachable {
+		args = append(args, "--attachable")
+	}
+	if spec.Internal {
+		args = append(args, "--internal")
+	}
+	return a.run(strings.Join(append(args, utils.ShellQuote(action.Name)), " "))
+}
+
+func (a *Applier) applySecret(action Action, desired Desired) error {
+	if action.Op == Remove {
+		pruned, err := secrets.Prune(a.IP, a.Username, a.Password, secrets.Secret, []string{action.Name}, nil)
+		for _, name := range pruned {
+			a.log("pruned secret %s", name)
+		}
+		return err
+	}
+
+	item := secrets.Item{
+		Name:   action.Name,
+		Data:   desired.SecretData[action.Name],
+		Labels: map[string]string{ManagedLabel: "true"},
+	}
+	_, _, err := secrets.Publish(a.IP, a.Username, a.Password, secrets.Secret, item)
+	return err
+}
+
+func (a *Applier) applyNode(action Action) error {
+	args := []string{"docker node update"}
+	for _, change := range action.Changes {
+		key := strings.TrimPrefix(change.Field, "labels.")
+		if change.Removed {
+			args = append(args, "--label-rm "+utils.ShellQuote(key))
+		} else {
+			args = append(args, "--label-add "+utils.ShellQuote(key+"="+change.New))
+		}
+	}
+	return a.run(strings.Join(append(args, utils.ShellQuote(action.Name)), " "))
+}
+
+func (a *Applier) applyService(action Action, desired Desired) error {
+	if action.Op == Remove || action.Op == Replace {
+		if err := a.run("docker service rm " + utils.ShellQuote(action.Name)); err != nil {
+			return err
+		}
+		if action.Op == Remove {
+			return nil
+		}
+	}
+
+	since, err := swarm.Now(a.IP, a.Username, a.Password)
+	if err != nil {
+		return err
+	}
+	if action.Op == Add || action.Op == Replace {
+		if err := a.createService(action.Name, desired); err != nil {
+			return err
+		}
+		return a.wait(action.Name, since)
+	}
+
+	args := []string{"docker service update", "--quiet", "--with-registry-auth"}
+	for _, change := range action.Changes {
+		field, key, _ := strings.Cut(change.Field, ".")
+		added := !change.Removed
+		switch field {
+		case "image":
+			args = append(args, "--image "+utils.ShellQuote(change.New))
+		case "replicas":
+			args = append(args, "--replicas "+change.New)
+		case "env":
+			// --env-add replaces an existing value of the same key
+			if added {
+				args = append(args, "--env-add "+utils.ShellQuote(key+"="+change.New))
+			} else {
+				args = append(args, "--env-rm "+utils.ShellQuote(key))
+			}
+		case "labels":
+			if added {
+				args = append(args, "--label-add "+utils.ShellQuote(key+"="+change.New))
+			} else {
+				args = append(args, "--label-rm "+utils.ShellQuote(key))
+			}
+		case "placement":
+			args = append(args, updateFlag("constraint", change))
+		case "networks":
+			args = append(args, updateFlag("network", change))
+		case "ports":
+			args = append(args, updateFlag("publish", change))
+		case "secrets":
+			if added {
+				args = append(args, "--secret-add "+secretMount(change.New))
+			} else {
+				args = append(args, "--secret-rm "+utils.ShellQuote(change.Old))
+			}
+		}
+	}
+	if err := a.run(strings.Join(append(args, utils.ShellQuote(action.Name)), " ")); err != nil {
+		return err
+	}
+	return a.wait(action.Name, since)
+}
+
+// wait waits for service, updated since since, to become healthy unless
+// Timeout is zero and records the healthy release for deploy rollback
+func (a *Applier) wait(service string, since time.Time) error {
+	if a.Timeout <= 0 {
+		a.log("no release of %s recorded without waiting for it to become healthy", service)
+		return nil
+	}
+	if err := swarm.WaitForService(a.IP, a.Username, a.Password, service, since, a.Timeout); err != nil {
+		return err
+	}
+	latest, added, err := release.Record(a.IP, a.Username, a.Password, service)
+	if added {
+		a.log("recorded release %d of %s", latest.Number, service)
+	}
+	return err
+}
+
+func (a *Applier) createService(name string, desired Desired) error {
+	spec := desired.service(name)
+	args := []string{
+		"docker service create", "--quiet", "--detach", "--with-registry-auth",
+		"--name " + utils.ShellQuote(name),
+		"--mode " + utils.ShellQuote(spec.Mode),
+		"--label " + ManagedLabel + "=true",
+	}
+	if spec.Mode == Replicated {
+		args = append(args, fmt.Sprintf("--replicas %d", spec.Replicas))
+	}
+	for _, env := range spec.Env {
+		args = append(args, "--env "+utils.ShellQuote(env))
+	}
+	for _, key := range sortedKeys(spec.Labels) {
+		args = append(args, "--label "+utils.ShellQuote(key+"="+spec.Labels[key]))
+	}
+	for _, constraint := range spec.Placement {
+		args = append(args, "--constraint "+utils.ShellQuote(constraint))
+	}
+	for _, network := range spec.Networks {
+		args = append(args, "--network "+utils.ShellQuote(network))
+	}
+	for _, secret := range spec.Secrets {
+		args = append(args, "--secret "+secretMount(secret))
+	}
+	for _, port := range spec.Ports {
+		args = append(args, "--publish "+utils.ShellQuote(port))
+	}
+	return a.run(strings.Join(append(args, utils.ShellQuote(spec.Image)), " "))
+}
+
+func (a *Applier) applyStack(action Action, desired Desired) error {
+	if action.Op == Remove {
+		return a.run(fmt.Sprintf("docker stack rm %s && rm -f %s",
+			utils.ShellQuote(action.Name), utils.ShellQuote(stackHashFile(action.Name))))
+	}
+
+	if a.DeployStack == nil {
+		return fmt.Errorf("no stack deployer")
+	}
+	if err := a.DeployStack(action.Name); err != nil {
+		return err
+	}
+	return a.run(fmt.Sprintf("mkdir -p %s && echo %s > %s",
+		StackDir, desired.StackHashes[action.Name], utils.ShellQuote(stackHashFile(action.Name))))
+}
+
+func (a *Applier) run(command string) error {
+	if _, err := utils.ExecuteRemoteCommand(a.IP, a.Username, a.Password, command); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *Applier) log(format string, args ...interface{}) {
+	if a.Log != nil {
+		a.Log(format, args...)
+	}
+}
+
+// updateFlag returns the docker service update flag adding or removing the
+// item of a list change
+func updateFlag(flag string, change FieldChange) string {
+	if !change.Removed {
+		return fmt.Sprintf("--%s-add %s", flag, utils.ShellQuote(change.New))
+	}
+	return fmt.Sprintf("--%s-rm %s", flag, utils.ShellQuote(change.Old))
+}
+
+// secretMount mounts a versioned secret under its unversioned name
+func secretMount(version string) string {
+	return utils.ShellQuote(fmt.Sprintf("source=%s,target=%s", version, secrets.BaseName(version)))
+}
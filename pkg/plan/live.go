@@ -0,0 +1,200 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// StackDir holds the content hash of every stack deployed by apply on the
+// manager
+const StackDir = "/var/lib/infra/stacks"
+
+// stackLabel is set by docker stack deploy on the objects of a stack
+const stackLabel = "com.docker.stack.namespace"
+
+// LiveService is a standalone service of the swarm
+type LiveService struct {
+	ID      string
+	Spec    types.ServiceSpec
+	Managed bool
+}
+
+// Live is the state of the swarm that apply manages. Services and networks
+// that belong to stacks are left out.
+type Live struct {
+	Networks map[string]swarm.Network
+	// Secrets maps secret names to their content-versioned secrets
+	Secrets map[string][]string
+	// ManagedSecrets holds the names of secrets created by apply
+	ManagedSecrets map[string]bool
+	Nodes          map[string]swarm.Node
+	Services       map[string]LiveService
+	// Stacks maps the stacks deployed by apply to their content hash
+	Stacks map[string]string
+}
+
+// ReadLive reads the live state of the swarm managed from ip
+func ReadLive(ip, username, password string) (*Live, error) {
+	live := &Live{
+		Networks:       make(map[string]swarm.Network),
+		Secrets:        make(map[string][]string),
+		ManagedSecrets: make(map[string]bool),
+		Nodes:          make(map[string]swarm.Node),
+		Services:       make(map[string]LiveService),
+		Stacks:         make(map[string]string),
+	}
+
+	networks, err := swarm.InspectNetworks(ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+	networkNames := make(map[string]string)
+	for _, network := range networks {
+		networkNames[network.ID] = network.Name
+		if network.Ingress || network.Labels[stackLabel] != "" {
+			continue
+		}
+		live.Networks[network.Name] = network
+	}
+
+	if err := readSecrets(ip, username, password, live); err != nil {
+		return nil, err
+	}
+
+	nodes, err := swarm.InspectNodes(ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		live.Nodes[node.Description.Hostname] = node
+	}
+
+	services, err := swarm.InspectServices(ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		if service.Spec.Labels[stackLabel] != "" {
+			continue
+		}
+		live.Services[service.Spec.Name] = LiveService{
+			ID:      service.ID,
+			Spec:    serviceSpec(service.Spec, networkNames),
+			Managed: service.Spec.Labels[ManagedLabel] == "true",
+		}
+	}
+
+	if err := readStacks(ip, username, password, live); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// serviceSpec converts a live service into the form used in infra.yaml,
+// with secrets given by their versioned names
+func serviceSpec(spec swarm.ServiceSpec, networkNames map[string]string) types.ServiceSpec {
+	container := spec.TaskTemplate.ContainerSpec
+	result := types.ServiceSpec{
+		Image:     container.Image,
+		Mode:      Replicated,
+		Env:       container.Env,
+		Labels:    make(map[string]string),
+		Placement: spec.TaskTemplate.Placement.Constraints,
+	}
+	if spec.Mode.Replicated != nil {
+		result.Replicas = spec.Mode.Replicated.Replicas
+	}
+	if spec.Mode.Global != nil {
+		result.Mode = Global
+	}
+	for key, value := range spec.Labels {
+		if key != ManagedLabel {
+			result.Labels[key] = value
+		}
+	}
+	for _, network := range spec.TaskTemplate.Networks {
+		name, ok := networkNames[network.Target]
+		if !ok {
+			name = network.Target
+		}
+		result.Networks = append(result.Networks, name)
+	}
+	for _, ref := range container.Secrets {
+		result.Secrets = append(result.Secrets, ref.SecretName)
+	}
+	for _, port := range spec.EndpointSpec.Ports {
+		result.Ports = append(result.Ports, fmt.Sprintf("%d:%d/%s", port.PublishedPort, port.TargetPort, port.Protocol))
+	}
+	return result
+}
+
+func readSecrets(ip, username, password string, live *Live) error {
+	ids, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("docker secret ls -q --filter label=%s", secrets.NameLabel))
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+	fields := strings.Fields(ids)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	output, err := utils.ExecuteRemoteCommand(ip, username, password, "docker secret inspect "+strings.Join(fields, " "))
+	if err != nil {
+		return fmt.Errorf("failed to inspect secrets: %w", err)
+	}
+	var inspected []struct {
+		Spec struct {
+			Name   string            `json:"Name"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Spec"`
+	}
+	if err := json.Unmarshal([]byte(output), &inspected); err != nil {
+		return fmt.Errorf("failed to parse secret inspect output: %w", err)
+	}
+	for _, secret := range inspected {
+		name := secret.Spec.Labels[secrets.NameLabel]
+		live.Secrets[name] = append(live.Secrets[name], secret.Spec.Name)
+		if secret.Spec.Labels[ManagedLabel] == "true" {
+			live.ManagedSecrets[name] = true
+		}
+	}
+	return nil
+}
+
+func readStacks(ip, username, password string, live *Live) error {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password, "docker stack ls --format '{{.Name}}'")
+	if err != nil {
+		return fmt.Errorf("failed to list stacks: %w", err)
+	}
+	running := make(map[string]bool)
+	for _, name := range strings.Fields(output) {
+		running[name] = true
+	}
+
+	output, err = utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("for f in %s/*.sha256; do [ -f \"$f\" ] && echo \"$(basename \"$f\" .sha256) $(cat \"$f\")\"; done; true", StackDir))
+	if err != nil {
+		return fmt.Errorf("failed to read stack hashes: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		name, hash, ok := strings.Cut(line, " ")
+		// A stack removed by hand is deployed again
+		if ok && running[name] {
+			live.Stacks[name] = strings.TrimSpace(hash)
+		}
+	}
+	return nil
+}
+
+// stackHashFile returns the file holding the hash of stack on the manager
+func stackHashFile(stack string) string {
+	return path.Join(StackDir, stack+".sha256")
+}
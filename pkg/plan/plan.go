@@ -0,0 +1,391 @@
+// Package plan compares the desired state in infra.yaml with the live swarm
+// and applies the difference.
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/secrets"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// ManagedLabel marks networks, services and secrets created by apply. Only
+// objects carrying it are pruned.
+const ManagedLabel = "infra.managed"
+
+// Kinds of objects, in the order they are added
+const (
+	Network = "network"
+	Secret  = "secret"
+	Node    = "node"
+	Service = "service"
+	Stack   = "stack"
+)
+
+var kindOrder = map[string]int{Network: 0, Secret: 1, Node: 2, Service: 3, Stack: 4}
+
+// Service modes
+const (
+	Replicated = "replicated"
+	Global     = "global"
+)
+
+// Operations of an action
+const (
+	Add     = "add"
+	Change  = "change"
+	Replace = "replace"
+	Remove  = "remove"
+)
+
+// FieldChange is a changed field. Old is empty when the field is added and
+// Removed is set when it is dropped, so fields set to an empty value are
+// still changes. Map entries and list items are separate changes, such as
+// env.LOG_LEVEL or one network.
+type FieldChange struct {
+	Field   string
+	Old     string
+	New     string
+	Removed bool
+}
+
+func (c FieldChange) String() string {
+	switch {
+	case c.Removed:
+		return fmt.Sprintf("- %s: %s", c.Field, c.Old)
+	case c.Old == "":
+		return fmt.Sprintf("+ %s: %s", c.Field, c.New)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Field, c.Old, c.New)
+	}
+}
+
+// Action is one step of a plan
+type Action struct {
+	Kind    string
+	Name    string
+	Op      string
+	Changes []FieldChange
+}
+
+// Plan is the list of actions that brings the swarm to the desired state
+type Plan struct {
+	Actions []Action
+}
+
+// Empty reports whether the swarm already matches the desired state
+func (p Plan) Empty() bool {
+	return len(p.Actions) == 0
+}
+
+// String renders the plan with one line per action and per changed field
+func (p Plan) String() string {
+	if p.Empty() {
+		return "No changes. The swarm matches the desired state.\n"
+	}
+
+	var b strings.Builder
+	counts := make(map[string]int)
+	for _, action := range p.Actions {
+		symbol := map[string]string{Add: "+", Change: "~", Replace: "-/+", Remove: "-"}[action.Op]
+		fmt.Fprintf(&b, "%s %s %s\n", symbol, action.Kind, action.Name)
+		for _, change := range action.Changes {
+			fmt.Fprintf(&b, "    %s\n", change)
+		}
+		counts[action.Op]++
+	}
+	fmt.Fprintf(&b, "\nPlan: %d to add, %d to change, %d to replace, %d to remove.\n",
+		counts[Add], counts[Change], counts[Replace], counts[Remove])
+	return b.String()
+}
+
+// Desired is the desired state with the content of its secrets and the
+// hashes of its rendered stacks resolved
+type Desired struct {
+	State       types.DesiredState
+	SecretData  map[string][]byte
+	StackHashes map[string]string
+}
+
+// secretVersion returns the versioned name of the desired secret name
+func (d Desired) secretVersion(name string) string {
+	return secrets.VersionedName(name, d.SecretData[name])
+}
+
+// service returns the desired service with defaults applied and secrets
+// replaced by their current versions
+func (d Desired) service(name string) types.ServiceSpec {
+	spec := d.State.Services[name]
+	if spec.Mode == "" {
+		spec.Mode = Replicated
+	}
+	switch {
+	case spec.Mode == Global:
+		spec.Replicas = 0
+	case spec.Replicas == 0:
+		spec.Replicas = 1
+	}
+	versions := make([]string, len(spec.Secrets))
+	for i, secret := range spec.Secrets {
+		versions[i] = d.secretVersion(secret)
+	}
+	spec.Secrets = versions
+	ports := make([]string, len(spec.Ports))
+	for i, port := range spec.Ports {
+		ports[i] = normalizePort(port)
+	}
+	spec.Ports = ports
+	return spec
+}
+
+// Diff returns the plan that turns live into desired. With prune set, managed
+// objects missing from desired are removed, as are undeclared labels of the
+// declared nodes. Declared nodes must already be in the swarm.
+func Diff(desired Desired, live *Live, prune bool) (Plan, error) {
+	var plan Plan
+	add := func(action Action) {
+		plan.Actions = append(plan.Actions, action)
+	}
+	state := desired.State
+
+	for name, spec := range state.Networks {
+		current, ok := live.Networks[name]
+		if !ok {
+			add(Action{Kind: Network, Name: name, Op: Add})
+			continue
+		}
+		driver := spec.Driver
+		if driver == "" {
+			driver = "overlay"
+		}
+		var changes []FieldChange
+		changes = append(changes, scalar("driver", current.Driver, driver)...)
+		changes = append(changes, scalar("attachable", strconv.FormatBool(current.Attachable), strconv.FormatBool(spec.Attachable))...)
+		changes = append(changes, scalar("internal", strconv.FormatBool(current.Internal), strconv.FormatBool(spec.Internal))...)
+		if len(changes) > 0 {
+			// Network options cannot be updated in place
+			add(Action{Kind: Network, Name: name, Op: Replace, Changes: changes})
+		}
+	}
+
+	for name := range state.Secrets {
+		version := desired.secretVersion(name)
+		versions := live.Secrets[name]
+		switch {
+		case len(versions) == 0:
+			add(Action{Kind: Secret, Name: name, Op: Add})
+		case !contains(versions, version):
+			add(Action{Kind: Secret, Name: name, Op: Change,
+				Changes: []FieldChange{{Field: "version", Old: strings.Join(versions, ","), New: version}}})
+		}
+	}
+
+	for hostname, spec := range state.Nodes {
+		node, ok := live.Nodes[hostname]
+		if !ok {
+			// Nodes join through swarm join; apply only labels them
+			return plan, fmt.Errorf("node %s is not in the swarm", hostname)
+		}
+		changes := mapChanges("labels", node.Spec.Labels, spec.Labels, prune)
+		if len(changes) > 0 {
+			add(Action{Kind: Node, Name: hostname, Op: Change, Changes: changes})
+		}
+	}
+
+	for name := range state.Services {
+		spec := desired.service(name)
+		current, ok := live.Services[name]
+		if !ok {
+			add(Action{Kind: Service, Name: name, Op: Add})
+			continue
+		}
+		changes := serviceChanges(current.Spec, spec)
+		if !current.Managed {
+			changes = append(changes, FieldChange{Field: "labels." + ManagedLabel, New: "true"})
+		}
+		op := Change
+		if current.Spec.Mode != spec.Mode {
+			// The mode of a service cannot be updated in place
+			op = Replace
+		}
+		if len(changes) > 0 {
+			add(Action{Kind: Service, Name: name, Op: op, Changes: changes})
+		}
+	}
+
+	for name := range state.Stacks {
+		hash := desired.StackHashes[name]
+		current, ok := live.Stacks[name]
+		switch {
+		case !ok:
+			add(Action{Kind: Stack, Name: name, Op: Add})
+		case current != hash:
+			add(Action{Kind: Stack, Name: name, Op: Change,
+				Changes: []FieldChange{{Field: "content", Old: current, New: hash}}})
+		}
+	}
+
+	if prune {
+		for name, network := range live.Networks {
+			if _, ok := state.Networks[name]; !ok && network.Labels[ManagedLabel] == "true" {
+				add(Action{Kind: Network, Name: name, Op: Remove})
+			}
+		}
+		for name := range live.ManagedSecrets {
+			if _, ok := state.Secrets[name]; !ok {
+				add(Action{Kind: Secret, Name: name, Op: Remove})
+			}
+		}
+		for name, service := range live.Services {
+			if _, ok := state.Services[name]; !ok && service.Managed {
+				add(Action{Kind: Service, Name: name, Op: Remove})
+			}
+		}
+		for name := range live.Stacks {
+			if _, ok := state.Stacks[name]; !ok {
+				add(Action{Kind: Stack, Name: name, Op: Remove})
+			}
+		}
+	}
+
+	sortActions(plan.Actions)
+	return plan, nil
+}
+
+// sortActions orders additions and changes by kind so that networks and
+// secrets exist before the services using them, followed by removals in
+// the reverse order
+func sortActions(actions []Action) {
+	rank := func(a Action) int {
+		if a.Op == Remove {
+			return 100 - kindOrder[a.Kind]
+		}
+		return kindOrder[a.Kind]
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		if rank(actions[i]) != rank(actions[j]) {
+			return rank(actions[i]) < rank(actions[j])
+		}
+		return actions[i].Name < actions[j].Name
+	})
+}
+
+func serviceChanges(current, desired types.ServiceSpec) []FieldChange {
+	var changes []FieldChange
+	if normalizeImage(current.Image) != normalizeImage(desired.Image) {
+		changes = append(changes, FieldChange{Field: "image", Old: current.Image, New: desired.Image})
+	}
+	changes = append(changes, scalar("mode", current.Mode, desired.Mode)...)
+	if desired.Mode == Replicated {
+		changes = append(changes, scalar("replicas", strconv.Itoa(current.Replicas), strconv.Itoa(desired.Replicas))...)
+	}
+	changes = append(changes, mapChanges("env", envMap(current.Env), envMap(desired.Env), true)...)
+	changes = append(changes, mapChanges("labels", current.Labels, desired.Labels, true)...)
+	changes = append(changes, setChanges("placement", current.Placement, desired.Placement)...)
+	changes = append(changes, setChanges("networks", current.Networks, desired.Networks)...)
+	changes = append(changes, setChanges("secrets", current.Secrets, desired.Secrets)...)
+	changes = append(changes, setChanges("ports", current.Ports, desired.Ports)...)
+	return changes
+}
+
+func scalar(field, current, desired string) []FieldChange {
+	if current == desired {
+		return nil
+	}
+	return []FieldChange{{Field: field, Old: current, New: desired}}
+}
+
+// mapChanges compares maps key by key. Keys missing from desired are only
+// reported with removeExtra set.
+func mapChanges(field string, current, desired map[string]string, removeExtra bool) []FieldChange {
+	var changes []FieldChange
+	for _, key := range sortedKeys(desired) {
+		if value, ok := current[key]; !ok || value != desired[key] {
+			changes = append(changes, FieldChange{Field: field + "." + key, Old: value, New: desired[key]})
+		}
+	}
+	if removeExtra {
+		for _, key := range sortedKeys(current) {
+			if _, ok := desired[key]; !ok {
+				changes = append(changes, FieldChange{Field: field + "." + key, Old: current[key], Removed: true})
+			}
+		}
+	}
+	return changes
+}
+
+func setChanges(field string, current, desired []string) []FieldChange {
+	var changes []FieldChange
+	for _, item := range sortedCopy(desired) {
+		if !contains(current, item) {
+			changes = append(changes, FieldChange{Field: field, New: item})
+		}
+	}
+	for _, item := range sortedCopy(current) {
+		if !contains(desired, item) {
+			changes = append(changes, FieldChange{Field: field, Old: item, Removed: true})
+		}
+	}
+	return changes
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// normalizeImage drops the digest swarm pins images to and adds the latest
+// tag to untagged images, as docker does when it stores a service spec, so
+// that images are compared by name and tag
+func normalizeImage(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	// A colon before the last slash separates a registry port, not a tag
+	if !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") {
+		image += ":latest"
+	}
+	return image
+}
+
+// normalizePort writes a port as published:target/protocol
+func normalizePort(port string) string {
+	spec, protocol, ok := strings.Cut(port, "/")
+	if !ok {
+		protocol = "tcp"
+	}
+	published, target, ok := strings.Cut(spec, ":")
+	if !ok {
+		target = published
+	}
+	return fmt.Sprintf("%s:%s/%s", published, target, protocol)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedCopy(items []string) []string {
+	sorted := append([]string(nil), items...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+func TestNormalizeImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"nginx", "nginx:latest"},
+		{"nginx:1.25", "nginx:1.25"},
+		{"nginx:1.25@sha256:0123abcd", "nginx:1.25"},
+		{"nginx@sha256:0123abcd", "nginx:latest"},
+		{"registry.example.com:5000/orders", "registry.example.com:5000/orders:latest"},
+		{"registry.example.com:5000/orders:1.4.2", "registry.example.com:5000/orders:1.4.2"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeImage(tt.image); got != tt.want {
+			t.Errorf("normalizeImage(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePort(t *testing.T) {
+	tests := []struct {
+		port string
+		want string
+	}{
+		{"80", "80:80/tcp"},
+		{"8080:80", "8080:80/tcp"},
+		{"53/udp", "53:53/udp"},
+		{"5353:53/udp", "5353:53/udp"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizePort(tt.port); got != tt.want {
+			t.Errorf("normalizePort(%q) = %q, want %q", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	node := func(labels map[string]string) swarm.Node {
+		var n swarm.Node
+		n.Spec.Labels = labels
+		return n
+	}
+	service := func(spec types.ServiceSpec) LiveService {
+		return LiveService{Spec: spec, Managed: true}
+	}
+
+	tests := []struct {
+		name    string
+		desired types.DesiredState
+		live    Live
+		prune   bool
+		want    []Action
+	}{
+		{
+			name:    "in sync",
+			desired: types.DesiredState{Services: map[string]types.ServiceSpec{"api": {Image: "api:1", Ports: []string{"80"}}}},
+			live: Live{Services: map[string]LiveService{
+				"api": service(types.ServiceSpec{Image: "api:1@sha256:0123abcd", Mode: Replicated, Replicas: 1, Ports: []string{"80:80/tcp"}}),
+			}},
+		},
+		{
+			name: "added objects",
+			desired: types.DesiredState{
+				Networks: map[string]types.NetworkSpec{"backend": {}},
+				Services: map[string]types.ServiceSpec{"api": {Image: "api:1"}},
+			},
+			want: []Action{
+				{Kind: Network, Name: "backend", Op: Add},
+				{Kind: Service, Name: "api", Op: Add},
+			},
+		},
+		{
+			name: "changed and removed fields",
+			desired: types.DesiredState{Services: map[string]types.ServiceSpec{
+				"api": {Image: "api:2", Replicas: 2, Env: []string{"LOG_LEVEL=", "MODE=fast"}},
+			}},
+			live: Live{Services: map[string]LiveService{
+				"api": service(types.ServiceSpec{Image: "api:1", Mode: Replicated, Replicas: 1,
+					Env: []string{"LOG_LEVEL=info", "DEBUG=1"}, Networks: []string{"backend"}}),
+			}},
+			want: []Action{{Kind: Service, Name: "api", Op: Change, Changes: []FieldChange{
+				{Field: "image", Old: "api:1", New: "api:2"},
+				{Field: "replicas", Old: "1", New: "2"},
+				{Field: "env.LOG_LEVEL", Old: "info", New: ""},
+				{Field: "env.MODE", New: "fast"},
+				{Field: "env.DEBUG", Old: "1", Removed: true},
+				{Field: "networks", Old: "backend", Removed: true},
+			}}},
+		},
+		{
+			name:    "mode change replaces the service",
+			desired: types.DesiredState{Services: map[string]types.ServiceSpec{"agent": {Image: "agent:1", Mode: Global}}},
+			live: Live{Services: map[string]LiveService{
+				"agent": service(types.ServiceSpec{Image: "agent:1", Mode: Replicated, Replicas: 1}),
+			}},
+			want: []Action{{Kind: Service, Name: "agent", Op: Replace, Changes: []FieldChange{
+				{Field: "mode", Old: Replicated, New: Global},
+			}}},
+		},
+		{
+			name:    "node labels kept without prune",
+			desired: types.DesiredState{Nodes: map[string]types.NodeSpec{"app-1": {Labels: map[string]string{"zone": "b"}}}},
+			live:    Live{Nodes: map[string]swarm.Node{"app-1": node(map[string]string{"zone": "a", "disk": "ssd"})}},
+			want: []Action{{Kind: Node, Name: "app-1", Op: Change, Changes: []FieldChange{
+				{Field: "labels.zone", Old: "a", New: "b"},
+			}}},
+		},
+		{
+			name:    "prune removes managed objects and undeclared node labels",
+			desired: types.DesiredState{Nodes: map[string]types.NodeSpec{"app-1": {}}},
+			live: Live{
+				Networks: map[string]swarm.Network{
+					"old":     {Labels: map[string]string{ManagedLabel: "true"}},
+					"ingress": {},
+				},
+				Nodes: map[string]swarm.Node{"app-1": node(map[string]string{"disk": "ssd"})},
+				Services: map[string]LiveService{
+					"old":    service(types.ServiceSpec{Image: "old:1"}),
+					"manual": {Spec: types.ServiceSpec{Image: "manual:1"}},
+				},
+			},
+			prune: true,
+			want: []Action{
+				{Kind: Node, Name: "app-1", Op: Change, Changes: []FieldChange{{Field: "labels.disk", Old: "ssd", Removed: true}}},
+				{Kind: Service, Name: "old", Op: Remove},
+				{Kind: Network, Name: "old", Op: Remove},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(Desired{State: tt.desired}, &tt.live, tt.prune)
+			if err != nil {
+				t.Fatalf("Diff failed: %v", err)
+			}
+			if !reflect.DeepEqual(got.Actions, tt.want) {
+				t.Errorf("Diff returned\n%s\nwant\n%s", got, Plan{Actions: tt.want})
+			}
+		})
+	}
+}
+
+func TestDiffUnknownNode(t *testing.T) {
+	desired := Desired{State: types.DesiredState{Nodes: map[string]types.NodeSpec{"app-9": {}}}}
+	if _, err := Diff(desired, &Live{}, false); err == nil {
+		t.Error("Diff accepted a node that is not in the swarm")
+	}
+}
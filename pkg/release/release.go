@@ -0,0 +1,136 @@
+// Package release keeps the history of the image and environment each
+// service ran when a deployment converged, so that it can be rolled back.
+package release
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// Dir holds one JSON lines file of releases per service on the manager
+const Dir = "/var/lib/infra/releases"
+
+// Release is a converged deployment of a service. Numbers start at 1 and
+// grow with every recorded release.
+type Release struct {
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	Image  string    `json:"image"`
+	Env    []string  `json:"env,omitempty"`
+}
+
+// Same reports whether r runs the same image and environment as other
+func (r Release) Same(other Release) bool {
+	if r.Image != other.Image || len(r.Env) != len(other.Env) {
+		return false
+	}
+	env, otherEnv := sortedCopy(r.Env), sortedCopy(other.Env)
+	for i := range env {
+		if env[i] != otherEnv[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Current returns the image and environment service runs now
+func Current(ip, username, password, service string) (Release, error) {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("docker service inspect --format '{{json .Spec.TaskTemplate.ContainerSpec}}' %s", service))
+	if err != nil {
+		return Release{}, fmt.Errorf("failed to inspect service %s: %w", service, err)
+	}
+	var spec swarm.ContainerSpec
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &spec); err != nil {
+		return Release{}, fmt.Errorf("failed to parse spec of service %s: %w", service, err)
+	}
+	return Release{Image: spec.Image, Env: spec.Env}, nil
+}
+
+// Record appends the current image and environment of service to its
+// history unless they match the latest release. It returns the latest
+// release and whether it was added.
+func Record(ip, username, password, service string) (Release, bool, error) {
+	current, err := Current(ip, username, password, service)
+	if err != nil {
+		return Release{}, false, err
+	}
+	releases, err := List(ip, username, password, service)
+	if err != nil {
+		return Release{}, false, err
+	}
+
+	current.Number = 1
+	if len(releases) > 0 {
+		latest := releases[len(releases)-1]
+		if latest.Same(current) {
+			return latest, false, nil
+		}
+		current.Number = latest.Number + 1
+	}
+	current.Time = time.Now().UTC()
+
+	line, err := json.Marshal(current)
+	if err != nil {
+		return Release{}, false, fmt.Errorf("failed to encode release: %w", err)
+	}
+	if _, err := utils.ExecuteRemoteCommandInput(ip, username, password,
+		fmt.Sprintf("mkdir -p %s && cat >> %s", Dir, file(service)), append(line, '\n')); err != nil {
+		return Release{}, false, fmt.Errorf("failed to record release of %s: %w", service, err)
+	}
+	return current, true, nil
+}
+
+// List returns the recorded releases of service, oldest first
+func List(ip, username, password, service string) ([]Release, error) {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("cat %s 2>/dev/null || true", file(service)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read releases of %s: %w", service, err)
+	}
+
+	var releases []Release
+	for _, line := range bytes.Split([]byte(output), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var release Release
+		if err := json.Unmarshal(line, &release); err != nil {
+			return nil, fmt.Errorf("failed to parse releases of %s: %w", service, err)
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// Get returns release number of service
+func Get(ip, username, password, service string, number int) (Release, error) {
+	releases, err := List(ip, username, password, service)
+	if err != nil {
+		return Release{}, err
+	}
+	for _, release := range releases {
+		if release.Number == number {
+			return release, nil
+		}
+	}
+	return Release{}, fmt.Errorf("service %s has no release %d", service, number)
+}
+
+func file(service string) string {
+	return path.Join(Dir, service+".jsonl")
+}
+
+func sortedCopy(items []string) []string {
+	sorted := append([]string(nil), items...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,302 @@
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/swarm"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+const (
+	// NameLabel holds the unversioned name on every managed secret or config
+	NameLabel = "infra.secret"
+	// HashLabel holds the content hash on every managed secret or config
+	HashLabel = "infra.hash"
+	// GeneratedLabel marks secrets holding generated passwords
+	GeneratedLabel = "infra.generated"
+)
+
+// Kind is the type of a swarm object holding file content
+type Kind string
+
+const (
+	Secret Kind = "secret"
+	Config Kind = "config"
+)
+
+var versionSuffix = regexp.MustCompile(`^(.+)_[0-9a-f]{12}$`)
+
+// Item is a value to publish as a swarm secret. Labels are set on the
+// object in addition to the name and hash labels.
+type Item struct {
+	Name   string
+	Data   []byte
+	Labels map[string]string
+}
+
+// SyncResult reports what Sync changed
+type SyncResult struct {
+	Created []string
+	Updated []string
+	Pruned  []string
+}
+
+// Hash returns the short content hash used in versioned names
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// VersionedName returns the swarm secret name for a given content version
+func VersionedName(name string, data []byte) string {
+	return fmt.Sprintf("%s_%s", name, Hash(data))
+}
+
+// BaseName strips the version suffix from a managed secret name
+func BaseName(versioned string) string {
+	if m := versionSuffix.FindStringSubmatch(versioned); m != nil {
+		return m[1]
+	}
+	return versioned
+}
+
+// Sync publishes items as versioned swarm secrets on the manager at ip and
+// moves every service that references an older version of a secret to the
+// current one. With prune set, managed secrets that no service references
+// and that are not the current version are removed.
+func Sync(ip, username, password string, items []Item, prune bool) (*SyncResult, error) {
+	result := &SyncResult{}
+
+	existing, err := listManaged(ip, username, password, Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string)
+	for _, item := range items {
+		name := VersionedName(item.Name, item.Data)
+		current[item.Name] = name
+
+		if existing[name] {
+			continue
+		}
+		if err := create(ip, username, password, Secret, item); err != nil {
+			return nil, err
+		}
+		existing[name] = true
+		result.Created = append(result.Created, name)
+	}
+
+	services, err := swarm.InspectServices(ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, service := range services {
+		var args []string
+		for _, ref := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+			latest, ok := current[BaseName(ref.SecretName)]
+			if !ok || !existing[ref.SecretName] || latest == ref.SecretName {
+				continue
+			}
+			args = append(args, "--secret-rm "+ref.SecretName, "--secret-add "+secretMount(latest, ref.File))
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		updateCmd := fmt.Sprintf("docker service update --quiet %s %s", strings.Join(args, " "), service.Spec.Name)
+		if _, err := utils.ExecuteRemoteCommand(ip, username, password, updateCmd); err != nil {
+			return nil, fmt.Errorf("failed to update service %s: %w", service.Spec.Name, err)
+		}
+		result.Updated = append(result.Updated, service.Spec.Name)
+	}
+
+	if !prune {
+		return result, nil
+	}
+
+	pruned, err := pruneUnused(ip, username, password, existing, current)
+	if err != nil {
+		return nil, err
+	}
+	result.Pruned = pruned
+	return result, nil
+}
+
+// Ensure creates the secret name from generate unless it already exists.
+// Generated secrets are not versioned, so redeploying keeps the password the
+// service was first started with. It reports whether the secret was created.
+func Ensure(ip, username, password, name string, generate func() ([]byte, error)) (bool, error) {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("docker secret ls --filter name=%s --format '{{.Name}}'", name))
+	if err != nil {
+		return false, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, existing := range strings.Fields(output) {
+		if existing == name {
+			return false, nil
+		}
+	}
+
+	data, err := generate()
+	if err != nil {
+		return false, err
+	}
+	createCmd := fmt.Sprintf("docker secret create --label %s=true %s -", GeneratedLabel, name)
+	if _, err := utils.ExecuteRemoteCommandInput(ip, username, password, createCmd, data); err != nil {
+		return false, fmt.Errorf("failed to create secret %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// Publish creates item as a versioned object of kind unless that version
+// already exists. It returns the versioned name and whether it was created.
+func Publish(ip, username, password string, kind Kind, item Item) (string, bool, error) {
+	existing, err := listManaged(ip, username, password, kind)
+	if err != nil {
+		return "", false, err
+	}
+	name := VersionedName(item.Name, item.Data)
+	if existing[name] {
+		return name, false, nil
+	}
+	if err := create(ip, username, password, kind, item); err != nil {
+		return "", false, err
+	}
+	return name, true, nil
+}
+
+// Prune removes the managed objects of kind that are older versions of the
+// given base names and that no service references any more, including in the
+// spec a rollback would restore. Versions listed in keep are never removed.
+func Prune(ip, username, password string, kind Kind, bases []string, keep []string) ([]string, error) {
+	existing, err := listManaged(ip, username, password, kind)
+	if err != nil {
+		return nil, err
+	}
+	services, err := swarm.InspectServices(ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(bases))
+	for _, base := range bases {
+		wanted[base] = true
+	}
+	inUse := references(services, kind)
+	for _, name := range keep {
+		inUse[name] = true
+	}
+
+	var pruned []string
+	for name := range existing {
+		if !wanted[BaseName(name)] || inUse[name] {
+			continue
+		}
+		if _, err := utils.ExecuteRemoteCommand(ip, username, password, fmt.Sprintf("docker %s rm %s", kind, name)); err != nil {
+			return pruned, fmt.Errorf("failed to remove %s %s: %w", kind, name, err)
+		}
+		pruned = append(pruned, name)
+	}
+	return pruned, nil
+}
+
+func create(ip, username, password string, kind Kind, item Item) error {
+	name := VersionedName(item.Name, item.Data)
+	labels := fmt.Sprintf("--label %s=%s --label %s=%s", NameLabel, item.Name, HashLabel, Hash(item.Data))
+	for key, value := range item.Labels {
+		labels += fmt.Sprintf(" --label %s=%s", key, value)
+	}
+	createCmd := fmt.Sprintf("docker %s create %s %s -", kind, labels, name)
+	if _, err := utils.ExecuteRemoteCommandInput(ip, username, password, createCmd, item.Data); err != nil {
+		return fmt.Errorf("failed to create %s %s: %w", kind, name, err)
+	}
+	return nil
+}
+
+// references returns the names of the objects of kind used by services.
+// Objects of the previous spec count too, so that docker service rollback
+// still finds them.
+func references(services []swarm.Service, kind Kind) map[string]bool {
+	inUse := make(map[string]bool)
+	for _, service := range services {
+		specs := []swarm.ServiceSpec{service.Spec}
+		if service.PreviousSpec != nil {
+			specs = append(specs, *service.PreviousSpec)
+		}
+		for _, spec := range specs {
+			container := spec.TaskTemplate.ContainerSpec
+			if kind == Config {
+				for _, ref := range container.Configs {
+					inUse[ref.ConfigName] = true
+				}
+				continue
+			}
+			for _, ref := range container.Secrets {
+				inUse[ref.SecretName] = true
+			}
+		}
+	}
+	return inUse
+}
+
+func pruneUnused(ip, username, password string, existing map[string]bool, current map[string]string) ([]string, error) {
+	// Inspect again so services updated above count with their new secrets
+	services, err := swarm.InspectServices(ip, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := references(services, Secret)
+	for _, name := range current {
+		inUse[name] = true
+	}
+
+	var pruned []string
+	for name := range existing {
+		if inUse[name] {
+			continue
+		}
+		if _, err := utils.ExecuteRemoteCommand(ip, username, password, "docker secret rm "+name); err != nil {
+			return pruned, fmt.Errorf("failed to remove secret %s: %w", name, err)
+		}
+		pruned = append(pruned, name)
+	}
+	return pruned, nil
+}
+
+func listManaged(ip, username, password string, kind Kind) (map[string]bool, error) {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("docker %s ls --filter label=%s --format '{{.Name}}'", kind, NameLabel))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %w", kind, err)
+	}
+
+	names := make(map[string]bool)
+	for _, name := range strings.Fields(output) {
+		names[name] = true
+	}
+	return names, nil
+}
+
+func secretMount(name string, file *swarm.FileTarget) string {
+	if file == nil {
+		return "source=" + name
+	}
+	mount := fmt.Sprintf("source=%s,target=%s", name, file.Name)
+	if file.UID != "" {
+		mount += ",uid=" + file.UID
+	}
+	if file.GID != "" {
+		mount += ",gid=" + file.GID
+	}
+	if file.Mode != 0 {
+		mount += fmt.Sprintf(",mode=%04o", file.Mode)
+	}
+	return mount
+}
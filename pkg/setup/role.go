@@ -0,0 +1,52 @@
+package setup
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// RoleCommands returns the shell commands that prepare a node for a role:
+// package installation, directories and the role's own setup steps
+func RoleCommands(def types.RoleDefinition) []string {
+	var cmds []string
+	if len(def.Packages) > 0 {
+		cmds = append(cmds,
+			"apt-get update",
+			"apt-get install -y "+strings.Join(def.Packages, " "))
+	}
+	for _, dir := range def.Directories {
+		cmds = append(cmds, "mkdir -p "+dir)
+	}
+	return append(cmds, def.Setup...)
+}
+
+// FirewallCommands returns the ufw rules that open a role's ports. Ports
+// without a protocol are opened for TCP.
+func FirewallCommands(def types.RoleDefinition) []string {
+	cmds := make([]string, 0, len(def.Ports))
+	for _, port := range def.Ports {
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+		cmds = append(cmds, "ufw allow "+port)
+	}
+	return cmds
+}
+
+// ApplyRole runs the setup commands of a built-in or custom role on a node
+func ApplyRole(ip, username, password string, role types.ServerRole) error {
+	def, ok := types.GetRoleDefinition(role)
+	if !ok {
+		return fmt.Errorf("unknown server role: %s", role)
+	}
+
+	for _, cmd := range RoleCommands(def) {
+		if _, err := utils.ExecuteRemoteCommand(ip, username, password, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Package stack provides the catalog of installable stack packs for common
+// backing services.
+package stack
+
+import (
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/cploutarchou/swarmforge/pkg/template"
+)
+
+//go:embed packs/*.yaml
+var packFiles embed.FS
+
+// Pack is a curated stack for a backing service. Params are the template
+// parameters with their defaults and Secrets the generated passwords.
+type Pack struct {
+	Name        string
+	Description string
+	Version     string
+	Params      map[string]string
+	Secrets     []string
+}
+
+var packs = map[string]Pack{
+	"postgres": {
+		Name:        "postgres",
+		Description: "PostgreSQL database",
+		Version:     "16-alpine",
+		Params:      map[string]string{"user": "app", "database": "app"},
+		Secrets:     []string{"password"},
+	},
+	"redis": {
+		Name:        "redis",
+		Description: "Redis with append-only persistence",
+		Version:     "7-alpine",
+		Params:      map[string]string{"memory": "256M"},
+		Secrets:     []string{"password"},
+	},
+	"minio": {
+		Name:        "minio",
+		Description: "MinIO S3-compatible object storage",
+		Version:     "RELEASE.2024-06-13T22-53-53Z",
+		Params:      map[string]string{"user": "admin"},
+		Secrets:     []string{"password"},
+	},
+	"rabbitmq": {
+		Name:        "rabbitmq",
+		Description: "RabbitMQ message broker with the management plugin",
+		Version:     "3.13-management-alpine",
+		Params:      map[string]string{"user": "app", "vhost": "/"},
+		Secrets:     []string{"password"},
+	},
+}
+
+// Data is what a pack template is rendered with. Secrets maps each generated
+// secret of the pack to its swarm secret name.
+type Data struct {
+	Name      string
+	Version   string
+	Placement []string
+	Params    map[string]string
+	Secrets   map[string]string
+}
+
+// Packs returns every pack sorted by name
+func Packs() []Pack {
+	list := make([]Pack, 0, len(packs))
+	for _, pack := range packs {
+		list = append(list, pack)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns the named pack
+func Get(name string) (Pack, error) {
+	pack, ok := packs[name]
+	if !ok {
+		names := make([]string, 0, len(packs))
+		for _, p := range Packs() {
+			names = append(names, p.Name)
+		}
+		return Pack{}, fmt.Errorf("unknown stack pack %q, available packs are %v", name, names)
+	}
+	return pack, nil
+}
+
+// Data returns the render data for installing the pack as stack. Overrides
+// replace parameter defaults and must name known parameters.
+func (p Pack) Data(stack string, overrides map[string]string) (Data, error) {
+	data := Data{
+		Name:    stack,
+		Version: p.Version,
+		Params:  make(map[string]string, len(p.Params)),
+		Secrets: make(map[string]string, len(p.Secrets)),
+	}
+	for key, value := range p.Params {
+		data.Params[key] = value
+	}
+	for key, value := range overrides {
+		if _, ok := p.Params[key]; !ok {
+			return data, fmt.Errorf("pack %s has no parameter %s", p.Name, key)
+		}
+		data.Params[key] = value
+	}
+	for _, secret := range p.Secrets {
+		data.Secrets[secret] = SecretName(stack, p.Name, secret)
+	}
+	return data, nil
+}
+
+// Render renders the pack's stack file and validates it
+func (p Pack) Render(generator *template.Generator, data Data) (string, error) {
+	content, err := packFiles.ReadFile("packs/" + p.Name + ".yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to read pack %s: %w", p.Name, err)
+	}
+	return generator.RenderStackSource(p.Name+".yaml", content, data)
+}
+
+// SecretName returns the swarm secret name of a generated pack secret
+func SecretName(stack, pack, secret string) string {
+	return fmt.Sprintf("%s_%s_%s", stack, pack, secret)
+}
+
+// GeneratePassword returns a random password of 32 hex characters
+func GeneratePassword() ([]byte, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	return []byte(hex.EncodeToString(buf)), nil
+}
@@ -0,0 +1,44 @@
+package swarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// Network is the subset of docker network inspect output used by the CLI
+type Network struct {
+	ID         string            `json:"Id"`
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	Attachable bool              `json:"Attachable"`
+	Internal   bool              `json:"Internal"`
+	Ingress    bool              `json:"Ingress"`
+	Labels     map[string]string `json:"Labels"`
+}
+
+// InspectNetworks returns the swarm-scoped networks managed from ip
+func InspectNetworks(ip, username, password string) ([]Network, error) {
+	ids, err := utils.ExecuteRemoteCommand(ip, username, password, "docker network ls -q --filter scope=swarm")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	fields := strings.Fields(ids)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		"docker network inspect "+strings.Join(fields, " "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect networks: %w", err)
+	}
+
+	var networks []Network
+	if err := json.Unmarshal([]byte(output), &networks); err != nil {
+		return nil, fmt.Errorf("failed to parse network inspect output: %w", err)
+	}
+	return networks, nil
+}
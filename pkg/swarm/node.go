@@ -0,0 +1,69 @@
+package swarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// Node is the subset of docker node inspect output used by the CLI
+type Node struct {
+	ID   string `json:"ID"`
+	Spec struct {
+		Labels       map[string]string `json:"Labels"`
+		Role         string            `json:"Role"`
+		Availability string            `json:"Availability"`
+	} `json:"Spec"`
+	Description struct {
+		Hostname string `json:"Hostname"`
+		Engine   struct {
+			EngineVersion string `json:"EngineVersion"`
+		} `json:"Engine"`
+	} `json:"Description"`
+	Status struct {
+		State string `json:"State"`
+		Addr  string `json:"Addr"`
+	} `json:"Status"`
+	ManagerStatus *struct {
+		Leader bool   `json:"Leader"`
+		Addr   string `json:"Addr"`
+	} `json:"ManagerStatus"`
+}
+
+// Address returns the node address. Managers can report 0.0.0.0 as their
+// status address, so the manager address is preferred when present.
+func (n Node) Address() string {
+	if n.ManagerStatus != nil && n.ManagerStatus.Addr != "" {
+		if host, _, err := net.SplitHostPort(n.ManagerStatus.Addr); err == nil {
+			return host
+		}
+	}
+	return n.Status.Addr
+}
+
+// InspectNodes returns every node of the swarm managed from ip
+func InspectNodes(ip, username, password string) ([]Node, error) {
+	ids, err := utils.ExecuteRemoteCommand(ip, username, password, "docker node ls -q")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	fields := strings.Fields(ids)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		"docker node inspect "+strings.Join(fields, " "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect nodes: %w", err)
+	}
+
+	var nodes []Node
+	if err := json.Unmarshal([]byte(output), &nodes); err != nil {
+		return nil, fmt.Errorf("failed to parse node inspect output: %w", err)
+	}
+	return nodes, nil
+}
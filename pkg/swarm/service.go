@@ -0,0 +1,102 @@
+package swarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+// FileTarget describes where a secret or config is mounted in a container
+type FileTarget struct {
+	Name string `json:"Name"`
+	UID  string `json:"UID"`
+	GID  string `json:"GID"`
+	Mode uint32 `json:"Mode"`
+}
+
+// SecretReference is a secret attached to a service
+type SecretReference struct {
+	File       *FileTarget `json:"File"`
+	SecretID   string      `json:"SecretID"`
+	SecretName string      `json:"SecretName"`
+}
+
+// ConfigReference is a config attached to a service
+type ConfigReference struct {
+	File       *FileTarget `json:"File"`
+	ConfigID   string      `json:"ConfigID"`
+	ConfigName string      `json:"ConfigName"`
+}
+
+// ContainerSpec is the subset of a service container spec used by the CLI
+type ContainerSpec struct {
+	Image   string            `json:"Image"`
+	Env     []string          `json:"Env"`
+	Secrets []SecretReference `json:"Secrets"`
+	Configs []ConfigReference `json:"Configs"`
+}
+
+// ServiceSpec is the subset of a service spec used by the CLI
+type ServiceSpec struct {
+	Name         string            `json:"Name"`
+	Labels       map[string]string `json:"Labels"`
+	TaskTemplate struct {
+		ContainerSpec ContainerSpec `json:"ContainerSpec"`
+		Placement     struct {
+			Constraints []string `json:"Constraints"`
+		} `json:"Placement"`
+		Networks []struct {
+			Target string `json:"Target"`
+		} `json:"Networks"`
+	} `json:"TaskTemplate"`
+	Mode struct {
+		Replicated *struct {
+			Replicas int `json:"Replicas"`
+		} `json:"Replicated"`
+		Global *struct{} `json:"Global"`
+	} `json:"Mode"`
+	EndpointSpec struct {
+		Ports []PortConfig `json:"Ports"`
+	} `json:"EndpointSpec"`
+}
+
+// PortConfig is a port published by a service
+type PortConfig struct {
+	Protocol      string `json:"Protocol"`
+	TargetPort    int    `json:"TargetPort"`
+	PublishedPort int    `json:"PublishedPort"`
+}
+
+// Service is the result of docker service inspect. PreviousSpec is the spec
+// docker service rollback restores, if any.
+type Service struct {
+	ID           string       `json:"ID"`
+	Spec         ServiceSpec  `json:"Spec"`
+	PreviousSpec *ServiceSpec `json:"PreviousSpec"`
+}
+
+// InspectServices returns every service in the swarm managed from ip
+func InspectServices(ip, username, password string) ([]Service, error) {
+	ids, err := utils.ExecuteRemoteCommand(ip, username, password, "docker service ls -q")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	fields := strings.Fields(ids)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		"docker service inspect "+strings.Join(fields, " "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect services: %w", err)
+	}
+
+	var services []Service
+	if err := json.Unmarshal([]byte(output), &services); err != nil {
+		return nil, fmt.Errorf("failed to parse service inspect output: %w", err)
+	}
+	return services, nil
+}
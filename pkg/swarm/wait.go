@@ -0,0 +1,308 @@
+package swarm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cploutarchou/swarmforge/pkg/utils"
+)
+
+const (
+	// pollInterval is how often the state of a deployment is checked
+	pollInterval = 3 * time.Second
+	// settleTime is how long services must stay converged, so that tasks
+	// crash-looping after a healthy start are caught
+	settleTime = 10 * time.Second
+	// maxTaskErrors limits the failed tasks reported on failure
+	maxTaskErrors = 5
+	// logLines is the number of log lines shown per failed task
+	logLines = 10
+)
+
+// ServiceState is the rollout state of a service
+type ServiceState struct {
+	Name    string
+	Running int
+	Desired int
+	// Update is the update status of the service, empty before its first
+	// update
+	Update string
+	// UpdateStarted is when the update reported by Update started
+	UpdateStarted time.Time
+}
+
+// Update states a deployment finishes in
+const (
+	UpdateCompleted   = "completed"
+	RollbackCompleted = "rollback_completed"
+)
+
+// Converged reports whether the service runs all desired replicas and its
+// update reached done. Tasks of services with a healthcheck only count as
+// running once they are healthy.
+func (s ServiceState) Converged(done string) bool {
+	return s.Running == s.Desired && (s.Update == "" || s.Update == done)
+}
+
+// failed reports whether the update was paused or, unless a rollback is
+// awaited, rolled back
+func (s ServiceState) failed(done string) bool {
+	if done == RollbackCompleted {
+		return strings.HasSuffix(s.Update, "paused")
+	}
+	return s.Update == "paused" || strings.HasPrefix(s.Update, "rollback")
+}
+
+// TaskError is a task that failed or was rejected, with the exit code and
+// last log lines of its container when it ran
+type TaskError struct {
+	Task     string
+	Node     string
+	State    string
+	Error    string
+	ExitCode string
+	Logs     []string
+}
+
+// ConvergeError is returned when a deployment does not come up
+type ConvergeError struct {
+	Target  string
+	Reason  string
+	Pending []ServiceState
+	Tasks   []TaskError
+}
+
+func (e *ConvergeError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s did not converge: %s", e.Target, e.Reason)
+	for _, s := range e.Pending {
+		fmt.Fprintf(&b, "\n  service %s: %d/%d running", s.Name, s.Running, s.Desired)
+		if s.Update != "" {
+			fmt.Fprintf(&b, ", update %s", s.Update)
+		}
+	}
+	for _, t := range e.Tasks {
+		fmt.Fprintf(&b, "\n  task %s on %s: %s: %s", t.Task, t.Node, t.State, t.Error)
+		if t.ExitCode != "" {
+			fmt.Fprintf(&b, " (exit code %s)", t.ExitCode)
+		}
+		for _, line := range t.Logs {
+			fmt.Fprintf(&b, "\n    | %s", line)
+		}
+	}
+	return b.String()
+}
+
+// ServiceStates returns the rollout state of the services matching filter,
+// a docker service ls filter such as name=api. Only services named in names
+// are kept when names is not empty, since name filters match prefixes.
+func ServiceStates(ip, username, password, filter string, names ...string) ([]ServiceState, error) {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("docker service ls --filter %s --format '{{.Name}}\t{{.Replicas}}'", filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var states []ServiceState
+	var found []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		name, replicas, ok := strings.Cut(line, "\t")
+		if !ok || (len(wanted) > 0 && !wanted[name]) {
+			continue
+		}
+		state := ServiceState{Name: name}
+		// Replicas read running/desired, optionally followed by details
+		// such as (max 1 per node)
+		if _, err := fmt.Sscanf(replicas, "%d/%d", &state.Running, &state.Desired); err != nil {
+			return nil, fmt.Errorf("failed to parse replicas %q of service %s", replicas, name)
+		}
+		states = append(states, state)
+		found = append(found, name)
+	}
+	if len(states) == 0 {
+		return nil, nil
+	}
+
+	output, err = utils.ExecuteRemoteCommand(ip, username, password,
+		"docker service inspect --format '{{.Spec.Name}}\t{{if .UpdateStatus}}{{.UpdateStatus.State}}\t{{json .UpdateStatus.StartedAt}}{{end}}' "+strings.Join(found, " "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect services: %w", err)
+	}
+	updates := make(map[string]ServiceState)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\t")
+		update := ServiceState{}
+		if len(fields) > 1 {
+			update.Update = strings.TrimSpace(fields[1])
+		}
+		if len(fields) > 2 {
+			// StartedAt is null while an update is being set up
+			update.UpdateStarted, _ = time.Parse(time.RFC3339Nano, strings.Trim(strings.TrimSpace(fields[2]), `"`))
+		}
+		updates[fields[0]] = update
+	}
+	for i := range states {
+		update := updates[states[i].Name]
+		states[i].Update = update.Update
+		states[i].UpdateStarted = update.UpdateStarted
+	}
+	return states, nil
+}
+
+// FailedTasks returns the most recent tasks of services that report an
+// error, with their exit codes and last log lines
+func FailedTasks(ip, username, password string, services []string) ([]TaskError, error) {
+	if len(services) == 0 {
+		return nil, nil
+	}
+	output, err := utils.ExecuteRemoteCommand(ip, username, password,
+		fmt.Sprintf("docker service ps %s --no-trunc --format '{{.ID}}\t{{.Name}}\t{{.Node}}\t{{.CurrentState}}\t{{.Error}}'",
+			strings.Join(services, " ")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	var tasks []TaskError
+	var ids []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) < 5 || strings.TrimSpace(fields[4]) == "" {
+			continue
+		}
+		task := TaskError{
+			Task:  strings.TrimSpace(strings.TrimPrefix(fields[1], `\_`)),
+			Node:  fields[2],
+			State: fields[3],
+			Error: strings.TrimSpace(fields[4]),
+		}
+		// Restarted tasks repeat the same error, tasks are listed newest
+		// first so the latest attempt is kept
+		key := task.Task + "\x00" + task.Error
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tasks = append(tasks, task)
+		ids = append(ids, fields[0])
+		if len(tasks) == maxTaskErrors {
+			break
+		}
+	}
+
+	for i, id := range ids {
+		code, err := utils.ExecuteRemoteCommand(ip, username, password,
+			"docker inspect --format '{{if .Status.ContainerStatus}}{{.Status.ContainerStatus.ExitCode}}{{end}}' "+id)
+		if err == nil {
+			if code = strings.TrimSpace(code); code != "" && code != "0" {
+				tasks[i].ExitCode = code
+			}
+		}
+		logs, err := utils.ExecuteRemoteCommand(ip, username, password,
+			fmt.Sprintf("docker service logs --raw --tail %d %s 2>&1", logLines, id))
+		if err == nil && strings.TrimSpace(logs) != "" {
+			tasks[i].Logs = strings.Split(strings.TrimRight(logs, "\n"), "\n")
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Task < tasks[j].Task })
+	return tasks, nil
+}
+
+// Now returns the time on the manager at ip. Deploys take it before they
+// start and pass it to the waits as since, so that update states are judged
+// against the manager's clock.
+func Now(ip, username, password string) (time.Time, error) {
+	output, err := utils.ExecuteRemoteCommand(ip, username, password, "date -u +%s")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read manager time: %w", err)
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse manager time %q: %w", strings.TrimSpace(output), err)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// WaitForStack waits until every service of stack has converged. Updates
+// that started before since belong to earlier deploys and are ignored.
+func WaitForStack(ip, username, password, stack string, since time.Time, timeout time.Duration) error {
+	return wait(ip, username, password, "stack "+stack, "label=com.docker.stack.namespace="+stack, nil, UpdateCompleted, since, timeout)
+}
+
+// WaitForService waits until service has converged, ignoring updates that
+// started before since
+func WaitForService(ip, username, password, service string, since time.Time, timeout time.Duration) error {
+	return wait(ip, username, password, "service "+service, "name="+service, []string{service}, UpdateCompleted, since, timeout)
+}
+
+// WaitForRollback waits until a rollback of service started after since has
+// converged
+func WaitForRollback(ip, username, password, service string, since time.Time, timeout time.Duration) error {
+	return wait(ip, username, password, "rollback of "+service, "name="+service, []string{service}, RollbackCompleted, since, timeout)
+}
+
+// wait polls the services matching filter until all of them have converged
+// to done and stayed so for settleTime. The update state of services not
+// updated since since is left out, so an earlier rollback does not fail a
+// deploy that leaves the service unchanged. It returns a ConvergeError with
+// the failed tasks when an update is paused or rolled back, or when timeout
+// passes.
+func wait(ip, username, password, target, filter string, names []string, done string, since time.Time, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var convergedAt time.Time
+	for {
+		states, err := ServiceStates(ip, username, password, filter, names...)
+		if err != nil {
+			return err
+		}
+
+		var pending []ServiceState
+		var services []string
+		reason := ""
+		for _, state := range states {
+			services = append(services, state.Name)
+			if !state.UpdateStarted.IsZero() && state.UpdateStarted.Before(since) {
+				state.Update = ""
+			}
+			if state.failed(done) {
+				reason = fmt.Sprintf("update of %s is %s", state.Name, state.Update)
+			}
+			if !state.Converged(done) {
+				pending = append(pending, state)
+			}
+		}
+
+		switch {
+		case len(states) == 0:
+			convergedAt = time.Time{}
+		case len(pending) == 0 && convergedAt.IsZero():
+			convergedAt = time.Now()
+		case len(pending) == 0 && time.Since(convergedAt) >= settleTime:
+			return nil
+		case len(pending) > 0:
+			convergedAt = time.Time{}
+		}
+
+		if reason == "" && time.Now().After(deadline) {
+			reason = fmt.Sprintf("timed out after %s", timeout)
+			if len(states) == 0 {
+				reason = fmt.Sprintf("no services found, timed out after %s", timeout)
+			}
+		}
+		if reason != "" {
+			tasks, err := FailedTasks(ip, username, password, services)
+			if err != nil {
+				return err
+			}
+			return &ConvergeError{Target: target, Reason: reason, Pending: pending, Tasks: tasks}
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,115 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CredentialLookup returns the stored password of user on server
+type CredentialLookup func(server, user string) (string, error)
+
+// funcs returns the functions available to every template. The credential
+// function calls the generator's lookup, so it can be set after parsing.
+func (g *Generator) funcs() template.FuncMap {
+	return template.FuncMap{
+		"quote":      quote,
+		"toYaml":     toYaml,
+		"indent":     indent,
+		"nindent":    nindent,
+		"default":    defaultValue,
+		"required":   required,
+		"b64enc":     b64enc,
+		"sha256":     sha256sum,
+		"env":        os.Getenv,
+		"credential": g.credential,
+	}
+}
+
+// SetCredentialLookup sets the function used by the credential template
+// function
+func (g *Generator) SetCredentialLookup(lookup CredentialLookup) {
+	g.lookupCredential = lookup
+}
+
+func (g *Generator) credential(server, user string) (string, error) {
+	if g.lookupCredential == nil {
+		return "", errors.New("credential lookups are not available")
+	}
+	return g.lookupCredential(server, user)
+}
+
+// quote renders a value as a double-quoted YAML scalar
+func quote(value interface{}) string {
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+// toYaml renders a value as YAML without the trailing newline
+func toYaml(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// indent prefixes every line of text with spaces
+func indent(spaces int, text string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
+
+// nindent is indent preceded by a newline, for use after a YAML key
+func nindent(spaces int, text string) string {
+	return "\n" + indent(spaces, text)
+}
+
+// defaultValue returns value unless it is empty, in which case fallback is
+// returned. It is called as {{ .Value | default "fallback" }}.
+func defaultValue(fallback interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || empty(value[0]) {
+		return fallback
+	}
+	return value[0]
+}
+
+// required fails rendering with message when value is empty
+func required(message string, value interface{}) (interface{}, error) {
+	if empty(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+func b64enc(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func sha256sum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
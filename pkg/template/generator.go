@@ -1,31 +1,164 @@
 package template
 
 import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"text/template"
 
+	"github.com/cploutarchou/swarmforge/pkg/compose"
 	"github.com/cploutarchou/swarmforge/pkg/types"
 )
 
-// Generator handles template generation
+// Template names
+const (
+	APIDeployment        = "api-deployment.yaml"
+	StandaloneDeployment = "standalone-deployment.yaml"
+	Traefik              = "traefik.yaml"
+)
+
+//go:embed templates/*
+var embedded embed.FS
+
+// Generator handles template generation. Templates are looked up in each
+// source in turn, so user templates shadow the embedded ones.
 type Generator struct {
-	templates map[string]*template.Template
+	sources          []source
+	templates        map[string]*template.Template
+	lookupCredential CredentialLookup
 }
 
-// NewGenerator creates a new template generator
+// NewGenerator creates a new template generator using the default search path
 func NewGenerator() *Generator {
-	return &Generator{
-		templates: make(map[string]*template.Template),
+	return NewGeneratorWithPath(SearchPath()...)
+}
+
+// NewGeneratorWithPath creates a template generator that looks in dirs, in
+// order, before the embedded templates. Missing directories are skipped.
+func NewGeneratorWithPath(dirs ...string) *Generator {
+	g := &Generator{templates: make(map[string]*template.Template)}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			g.sources = append(g.sources, source{name: dir, files: os.DirFS(dir)})
+		}
 	}
+	files, _ := fs.Sub(embedded, "templates")
+	g.sources = append(g.sources, source{name: EmbeddedSource, files: files})
+	return g
 }
 
-// GenerateDeployment generates deployment YAML from template
+// DeploymentTemplate returns the template name used for an application type
+func DeploymentTemplate(appType types.AppType) (string, error) {
+	switch appType {
+	case types.APIApp:
+		return APIDeployment, nil
+	case types.StandaloneApp:
+		return StandaloneDeployment, nil
+	default:
+		return "", fmt.Errorf("unknown app type %q, valid types are %v", appType, types.ValidAppTypes())
+	}
+}
+
+// GenerateDeployment generates deployment YAML from the template selected by
+// the config's AppType
 func (g *Generator) GenerateDeployment(config types.DeploymentConfig) (string, error) {
-	// TODO: Implement deployment template generation
-	return "", nil
+	name, err := DeploymentTemplate(config.AppType)
+	if err != nil {
+		return "", err
+	}
+	return g.RenderStack(name, config)
 }
 
-// GenerateTraefikConfig generates Traefik configuration YAML
+// GenerateTraefikConfig generates the Traefik stack YAML
 func (g *Generator) GenerateTraefikConfig(config types.DeploymentConfig) (string, error) {
-	// TODO: Implement Traefik config generation
-	return "", nil
+	return g.RenderStack(Traefik, config)
+}
+
+// RenderStack renders a stack template and validates the output against the
+// Compose format supported by swarm, so mistakes surface before upload
+func (g *Generator) RenderStack(name string, data interface{}) (string, error) {
+	output, err := g.Render(name, data)
+	if err != nil {
+		return "", err
+	}
+	if err := compose.Check([]byte(output)); err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	return output, nil
+}
+
+// RenderStackFile renders a stack file outside the search path, such as a
+// project compose file, and validates the output
+func (g *Generator) RenderStackFile(path string, data interface{}) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stack file: %w", err)
+	}
+	output, err := g.RenderStackSource(filepath.Base(path), content, data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return output, nil
+}
+
+// RenderStackSource renders stack template content that is not on the
+// search path and validates the output
+func (g *Generator) RenderStackSource(name string, content []byte, data interface{}) (string, error) {
+	tmpl, err := g.parse(name, content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	if err := compose.Check(buf.Bytes()); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render executes the named template with data
+func (g *Generator) Render(name string, data interface{}) (string, error) {
+	tmpl, err := g.lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// lookup parses a template on first use and caches it
+func (g *Generator) lookup(name string) (*template.Template, error) {
+	if tmpl, ok := g.templates[name]; ok {
+		return tmpl, nil
+	}
+
+	content, _, err := g.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := g.parse(name, content)
+	if err != nil {
+		return nil, err
+	}
+	g.templates[name] = tmpl
+	return tmpl, nil
+}
+
+func (g *Generator) parse(name string, content []byte) (*template.Template, error) {
+	// Missing map keys fail instead of rendering as <no value>
+	tmpl, err := template.New(name).Funcs(g.funcs()).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return tmpl, nil
 }
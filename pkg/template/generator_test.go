@@ -0,0 +1,117 @@
+package template
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestGenerateGolden(t *testing.T) {
+	updateConfig := &types.UpdateConfig{Parallelism: 1, Delay: "10s", FailureAction: "rollback", Monitor: "30s", Order: "start-first"}
+	rollbackConfig := &types.UpdateConfig{Parallelism: 1, Delay: "5s", FailureAction: "pause", Monitor: "30s", Order: "start-first"}
+
+	tests := []struct {
+		golden string
+		render func(g *Generator) (string, error)
+	}{
+		{
+			golden: "api-deployment.golden",
+			render: func(g *Generator) (string, error) {
+				return g.GenerateDeployment(types.DeploymentConfig{
+					ServiceConfig: types.ServiceConfig{
+						ServiceName: "orders",
+						AppType:     types.APIApp,
+						Language:    types.Go,
+						ImageName:   "registry.example.com/orders",
+						Version:     "1.4.2",
+						Replicas:    2,
+						CPU:         "0.5",
+						Memory:      "512M",
+						Port:        8080,
+						Healthcheck: []string{"CMD", "/app/healthcheck", "http://localhost:8080/health"},
+						Environment: []string{"LOG_LEVEL=info"},
+						Domain:      "example.com",
+						Subdomain:   "orders",
+						UseTraefik:  true,
+					},
+					Labels: map[string]string{
+						"traefik.enable":                                        "true",
+						"traefik.http.routers.orders.rule":                      "Host(`orders.example.com`)",
+						"traefik.http.services.orders.loadbalancer.server.port": "8080",
+					},
+					LogDriver:      "json-file",
+					LogOptions:     map[string]string{"max-size": "10m"},
+					Placement:      []string{"node.labels.role == apps"},
+					UpdateConfig:   updateConfig,
+					RollbackConfig: rollbackConfig,
+					MaxAttempts:    3,
+					Configs:        []types.FileMount{{Name: "app-config", Target: "/etc/orders/config.yaml", Object: "orders_app-config_1a2b3c4d"}},
+					Secrets:        []types.FileMount{{Name: "db-password", Target: "db-password", Object: "orders_db-password_5e6f7a8b"}},
+				})
+			},
+		},
+		{
+			golden: "standalone-deployment.golden",
+			render: func(g *Generator) (string, error) {
+				return g.GenerateDeployment(types.DeploymentConfig{
+					ServiceConfig: types.ServiceConfig{
+						ServiceName: "worker",
+						AppType:     types.StandaloneApp,
+						ImageName:   "registry.example.com/worker",
+						Version:     "2.0.0",
+						Replicas:    1,
+						CPU:         "1",
+						Memory:      "1G",
+						Command:     []string{"worker", "--queue", "jobs"},
+					},
+					Placement:      []string{"node.labels.role == apps"},
+					UpdateConfig:   &types.UpdateConfig{Parallelism: 1, Delay: "10s", FailureAction: "rollback", Monitor: "30s", Order: "stop-first"},
+					RollbackConfig: &types.UpdateConfig{Parallelism: 1, Delay: "5s", FailureAction: "pause", Monitor: "30s", Order: "stop-first"},
+					MaxAttempts:    3,
+				})
+			},
+		},
+		{
+			golden: "traefik.golden",
+			render: func(g *Generator) (string, error) {
+				return g.GenerateTraefikConfig(types.DeploymentConfig{
+					ServiceConfig: types.ServiceConfig{Domain: "example.com"},
+					Email:         "admin@example.com",
+					Entrypoints: map[string]types.Entrypoint{
+						"postgres": {Port: 5432},
+						"dns":      {Port: 53, Protocol: "udp"},
+					},
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			// Only the embedded templates, so user templates cannot interfere
+			got, err := tt.render(NewGeneratorWithPath())
+			if err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file, run go test -update: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s, run go test -update to accept it\n--- got ---\n%s", path, got)
+			}
+		})
+	}
+}
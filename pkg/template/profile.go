@@ -0,0 +1,84 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// Profile holds the per-language defaults used for scaffolding and deploying
+// a service. Healthchecks only use tools present in the profile's runtime
+// image, since curl is missing from slim and Alpine images.
+type Profile struct {
+	Language   types.Language
+	Port       int
+	Dockerfile string
+	// healthcheck returns the healthcheck test for a service on port
+	healthcheck func(port int) []string
+}
+
+var profiles = map[types.Language]Profile{
+	types.Go: {
+		Language:   types.Go,
+		Port:       8080,
+		Dockerfile: "go.Dockerfile",
+		healthcheck: func(port int) []string {
+			return []string{"CMD", "wget", "-q", "--spider", healthURL(port)}
+		},
+	},
+	types.Python: {
+		Language:   types.Python,
+		Port:       8000,
+		Dockerfile: "python.Dockerfile",
+		healthcheck: func(port int) []string {
+			return []string{"CMD", "python", "-c",
+				fmt.Sprintf("import urllib.request; urllib.request.urlopen('%s', timeout=5)", healthURL(port))}
+		},
+	},
+	types.Node: {
+		Language:   types.Node,
+		Port:       3000,
+		Dockerfile: "node.Dockerfile",
+		healthcheck: func(port int) []string {
+			return []string{"CMD", "node", "-e",
+				fmt.Sprintf("require('http').get('%s', r => process.exit(r.statusCode < 400 ? 0 : 1)).on('error', () => process.exit(1))", healthURL(port))}
+		},
+	},
+	types.Java: {
+		Language:   types.Java,
+		Port:       8080,
+		Dockerfile: "java.Dockerfile",
+		healthcheck: func(port int) []string {
+			return []string{"CMD", "wget", "-q", "--spider", healthURL(port)}
+		},
+	},
+}
+
+// ProfileFor returns the profile of a language
+func ProfileFor(lang types.Language) (Profile, error) {
+	profile, ok := profiles[lang]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown language %q, valid languages are %v", lang, types.ValidLanguages())
+	}
+	return profile, nil
+}
+
+// Healthcheck returns the healthcheck test for a service listening on port
+func (p Profile) Healthcheck(port int) []string {
+	return p.healthcheck(port)
+}
+
+// Apply fills the port and, for API services, the healthcheck of config
+// where they are not set
+func (p Profile) Apply(config *types.ServiceConfig) {
+	if config.Port == 0 {
+		config.Port = p.Port
+	}
+	if config.AppType == types.APIApp && len(config.Healthcheck) == 0 {
+		config.Healthcheck = p.Healthcheck(config.Port)
+	}
+}
+
+func healthURL(port int) string {
+	return fmt.Sprintf("http://localhost:%d/health", port)
+}
@@ -0,0 +1,82 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/config"
+)
+
+// EmbeddedSource names the templates built into the binary
+const EmbeddedSource = "embedded"
+
+type source struct {
+	name  string
+	files fs.FS
+}
+
+// Info describes a template and where it is loaded from. Shadows lists the
+// sources of templates with the same name that it overrides.
+type Info struct {
+	Name    string
+	Source  string
+	Shadows []string
+}
+
+// SearchPath returns the directories searched for templates before the
+// embedded ones: ./.infra/templates, then ~/.infra/templates
+func SearchPath() []string {
+	dirs := []string{filepath.Join(".infra", "templates")}
+	if dir, err := config.Dir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "templates"))
+	}
+	return dirs
+}
+
+// Read returns the content of the named template and the source it was
+// found in
+func (g *Generator) Read(name string) ([]byte, string, error) {
+	for _, src := range g.sources {
+		content, err := fs.ReadFile(src.files, name)
+		if err == nil {
+			return content, src.name, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("failed to read template %s from %s: %w", name, src.name, err)
+		}
+	}
+	return nil, "", fmt.Errorf("template %s not found", name)
+}
+
+// List returns every template on the search path sorted by name
+func (g *Generator) List() ([]Info, error) {
+	found := make(map[string]*Info)
+	for _, src := range g.sources {
+		entries, err := fs.ReadDir(src.files, ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list templates in %s: %w", src.name, err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			if info, ok := found[name]; ok {
+				info.Shadows = append(info.Shadows, src.name)
+				continue
+			}
+			found[name] = &Info{Name: name, Source: src.name}
+		}
+	}
+
+	infos := make([]Info, 0, len(found))
+	for _, info := range found {
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
@@ -0,0 +1,212 @@
+// Package traefik renders Traefik middlewares from the catalog in the
+// configuration as swarm service labels.
+package traefik
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// HashLookup returns a bcrypt hash of the stored password of user on server
+type HashLookup func(server, user string) (string, error)
+
+// securityHeaders are the headers set by the security_headers middleware
+var securityHeaders = map[string]string{
+	"stsseconds":           "31536000",
+	"stsincludesubdomains": "true",
+	"stspreload":           "true",
+	"forcestsheader":       "true",
+	"contenttypenosniff":   "true",
+	"browserxssfilter":     "true",
+	"framedeny":            "true",
+	"referrerpolicy":       "strict-origin-when-cross-origin",
+}
+
+// Kind returns the Traefik middleware type of m, or an error unless exactly
+// one type is set
+func Kind(m types.Middleware) (string, error) {
+	var kinds []string
+	if len(m.BasicAuth) > 0 {
+		kinds = append(kinds, "basicauth")
+	}
+	if m.RateLimit != nil {
+		kinds = append(kinds, "ratelimit")
+	}
+	if len(m.IPAllowList) > 0 {
+		// Traefik v2 names the allowlist middleware ipwhitelist
+		kinds = append(kinds, "ipwhitelist")
+	}
+	if m.SecurityHeaders {
+		kinds = append(kinds, "headers")
+	}
+	if m.Compress {
+		kinds = append(kinds, "compress")
+	}
+	if m.Retry > 0 {
+		kinds = append(kinds, "retry")
+	}
+	if len(m.StripPrefix) > 0 {
+		kinds = append(kinds, "stripprefix")
+	}
+	if m.RedirectScheme != "" {
+		kinds = append(kinds, "redirectscheme")
+	}
+	if m.RedirectRegex != nil {
+		kinds = append(kinds, "redirectregex")
+	}
+
+	switch len(kinds) {
+	case 0:
+		return "", fmt.Errorf("middleware sets no type")
+	case 1:
+		return kinds[0], nil
+	default:
+		return "", fmt.Errorf("middleware sets %s, use one type per middleware and a chain to combine them",
+			strings.Join(kinds, " and "))
+	}
+}
+
+// Labels returns the labels defining middleware name
+func Labels(name string, m types.Middleware, lookup HashLookup) (map[string]string, error) {
+	kind, err := Kind(m)
+	if err != nil {
+		return nil, fmt.Errorf("middleware %s: %w", name, err)
+	}
+
+	prefix := fmt.Sprintf("traefik.http.middlewares.%s.%s", name, kind)
+	labels := make(map[string]string)
+	switch kind {
+	case "basicauth":
+		users, err := htpasswd(m.BasicAuth, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %s: %w", name, err)
+		}
+		labels[prefix+".users"] = users
+	case "ratelimit":
+		labels[prefix+".average"] = strconv.Itoa(m.RateLimit.Average)
+		if m.RateLimit.Burst > 0 {
+			labels[prefix+".burst"] = strconv.Itoa(m.RateLimit.Burst)
+		}
+	case "ipwhitelist":
+		labels[prefix+".sourcerange"] = strings.Join(m.IPAllowList, ",")
+	case "headers":
+		for key, value := range securityHeaders {
+			labels[prefix+"."+key] = value
+		}
+	case "compress":
+		labels[prefix] = "true"
+	case "retry":
+		labels[prefix+".attempts"] = strconv.Itoa(m.Retry)
+	case "stripprefix":
+		labels[prefix+".prefixes"] = strings.Join(m.StripPrefix, ",")
+	case "redirectscheme":
+		labels[prefix+".scheme"] = m.RedirectScheme
+		labels[prefix+".permanent"] = "true"
+	case "redirectregex":
+		labels[prefix+".regex"] = m.RedirectRegex.Regex
+		labels[prefix+".replacement"] = m.RedirectRegex.Replacement
+		labels[prefix+".permanent"] = strconv.FormatBool(m.RedirectRegex.Permanent)
+	}
+	return labels, nil
+}
+
+// htpasswd builds the users value of a basicauth middleware from credential
+// references. The credential store keeps one hash per credential, since
+// Traefik drops middlewares that services define differently. Dollar signs
+// are doubled because stack files interpolate them.
+func htpasswd(refs []string, lookup HashLookup) (string, error) {
+	if lookup == nil {
+		return "", fmt.Errorf("basic auth needs the credential store")
+	}
+
+	users := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		server, user, ok := strings.Cut(ref, "/")
+		if !ok || server == "" || user == "" {
+			return "", fmt.Errorf("malformed basic auth user %q, expected server/username", ref)
+		}
+		hash, err := lookup(server, user)
+		if err != nil {
+			return "", err
+		}
+		users = append(users, user+":"+strings.ReplaceAll(hash, "$", "$$"))
+	}
+	return strings.Join(users, ","), nil
+}
+
+// Router returns the labels that attach the named middlewares and chains to
+// the router of service, together with every definition they need. Chains
+// become Traefik chain middlewares, so services using the same chain share
+// one definition.
+func Router(service string, names []string, catalog types.TraefikConfig, lookup HashLookup) (map[string]string, error) {
+	labels := make(map[string]string)
+	defined := make(map[string]bool)
+
+	var define func(name string, path []string) error
+	define = func(name string, path []string) error {
+		if defined[name] {
+			return nil
+		}
+		for _, seen := range path {
+			if seen == name {
+				return fmt.Errorf("chain %s includes itself: %s", name, strings.Join(append(path, name), " -> "))
+			}
+		}
+
+		if members, ok := catalog.Chains[name]; ok {
+			refs := make([]string, 0, len(members))
+			for _, member := range members {
+				if err := define(member, append(path, name)); err != nil {
+					return err
+				}
+				refs = append(refs, member+"@docker")
+			}
+			labels[fmt.Sprintf("traefik.http.middlewares.%s.chain.middlewares", name)] = strings.Join(refs, ",")
+			defined[name] = true
+			return nil
+		}
+
+		m, ok := catalog.Middlewares[name]
+		if !ok {
+			return fmt.Errorf("unknown middleware or chain %s, known names are %v", name, Names(catalog))
+		}
+		mwLabels, err := Labels(name, m, lookup)
+		if err != nil {
+			return err
+		}
+		for key, value := range mwLabels {
+			labels[key] = value
+		}
+		defined[name] = true
+		return nil
+	}
+
+	refs := make([]string, 0, len(names))
+	for _, name := range names {
+		if err := define(name, nil); err != nil {
+			return nil, err
+		}
+		refs = append(refs, name+"@docker")
+	}
+	if len(refs) > 0 {
+		labels[fmt.Sprintf("traefik.http.routers.%s.middlewares", service)] = strings.Join(refs, ",")
+	}
+	return labels, nil
+}
+
+// Names returns the sorted middleware and chain names of a catalog
+func Names(catalog types.TraefikConfig) []string {
+	names := make([]string, 0, len(catalog.Middlewares)+len(catalog.Chains))
+	for name := range catalog.Middlewares {
+		names = append(names, name)
+	}
+	for name := range catalog.Chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,145 @@
+package traefik
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cploutarchou/swarmforge/pkg/types"
+)
+
+// Protocols of a route
+const (
+	HTTP = "http"
+	TCP  = "tcp"
+	UDP  = "udp"
+)
+
+// TLS modes of a TCP route
+const (
+	TLSPassthrough = "passthrough"
+	TLSTerminate   = "terminate"
+	TLSNone        = "none"
+)
+
+// Route describes how Traefik reaches a service. Host is matched with Host
+// for HTTP and with HostSNI for TCP; UDP routes have no rule.
+type Route struct {
+	Service    string
+	Protocol   string
+	Host       string
+	Port       int
+	Entrypoint string
+	TLS        string
+}
+
+// RouteLabels returns the router and service labels of r
+func RouteLabels(r Route) (map[string]string, error) {
+	if r.Protocol == "" {
+		r.Protocol = HTTP
+	}
+	labels := map[string]string{"traefik.enable": "true"}
+	router := fmt.Sprintf("traefik.%s.routers.%s", r.Protocol, r.Service)
+	labels[router+".service"] = r.Service
+	labels[fmt.Sprintf("traefik.%s.services.%s.loadbalancer.server.port", r.Protocol, r.Service)] = strconv.Itoa(r.Port)
+
+	switch r.Protocol {
+	case HTTP:
+		if r.Host == "" {
+			return nil, fmt.Errorf("HTTP routes need a host")
+		}
+		entrypoint := r.Entrypoint
+		if entrypoint == "" {
+			entrypoint = "websecure"
+		}
+		labels[router+".rule"] = fmt.Sprintf("Host(`%s`)", r.Host)
+		labels[router+".entrypoints"] = entrypoint
+		labels[router+".tls.certresolver"] = "letsencrypt"
+	case TCP:
+		if r.Entrypoint == "" {
+			return nil, fmt.Errorf("TCP routes need an entrypoint")
+		}
+		labels[router+".entrypoints"] = r.Entrypoint
+		switch r.TLS {
+		case TLSPassthrough, TLSTerminate:
+			if r.Host == "" {
+				return nil, fmt.Errorf("TCP routes with TLS need a host for HostSNI")
+			}
+			labels[router+".rule"] = fmt.Sprintf("HostSNI(`%s`)", r.Host)
+			if r.TLS == TLSPassthrough {
+				labels[router+".tls.passthrough"] = "true"
+			} else {
+				labels[router+".tls.certresolver"] = "letsencrypt"
+			}
+		case TLSNone:
+			// Without TLS there is no SNI, so the router takes the whole
+			// entrypoint
+			labels[router+".rule"] = "HostSNI(`*`)"
+		default:
+			return nil, fmt.Errorf("invalid TLS mode %q, expected %s, %s or %s", r.TLS, TLSPassthrough, TLSTerminate, TLSNone)
+		}
+	case UDP:
+		if r.Entrypoint == "" {
+			return nil, fmt.Errorf("UDP routes need an entrypoint")
+		}
+		labels[router+".entrypoints"] = r.Entrypoint
+	default:
+		return nil, fmt.Errorf("invalid protocol %q, expected %s, %s or %s", r.Protocol, HTTP, TCP, UDP)
+	}
+	return labels, nil
+}
+
+// ParseEntrypoint parses an entrypoint given as name=port[/tcp|/udp]
+func ParseEntrypoint(spec string) (string, types.Entrypoint, error) {
+	name, address, ok := strings.Cut(spec, "=")
+	if !ok || name == "" {
+		return "", types.Entrypoint{}, fmt.Errorf("invalid entrypoint %q, expected name=port[/udp]", spec)
+	}
+	portSpec, protocol, _ := strings.Cut(address, "/")
+	port, err := strconv.Atoi(portSpec)
+	if err != nil {
+		return "", types.Entrypoint{}, fmt.Errorf("invalid entrypoint %q, expected name=port[/udp]", spec)
+	}
+	ep := types.Entrypoint{Port: port, Protocol: protocol}
+	if err := CheckEntrypoint(name, ep); err != nil {
+		return "", types.Entrypoint{}, err
+	}
+	return name, ep, nil
+}
+
+// CheckEntrypoint reports an invalid port or protocol of entrypoint name, and
+// names taken by the HTTP entrypoints
+func CheckEntrypoint(name string, ep types.Entrypoint) error {
+	if name == "web" || name == "websecure" {
+		return fmt.Errorf("entrypoint %s is reserved for HTTP", name)
+	}
+	if ep.Port < 1 || ep.Port > 65535 {
+		return fmt.Errorf("entrypoint %s has invalid port %d", name, ep.Port)
+	}
+	if ep.Port == 80 || ep.Port == 443 {
+		return fmt.Errorf("entrypoint %s uses port %d of the HTTP entrypoints", name, ep.Port)
+	}
+	if ep.Protocol != "" && ep.Protocol != TCP && ep.Protocol != UDP {
+		return fmt.Errorf("entrypoint %s has invalid protocol %q, expected %s or %s", name, ep.Protocol, TCP, UDP)
+	}
+	return nil
+}
+
+// EntrypointProtocol returns the protocol of ep, defaulting to tcp
+func EntrypointProtocol(ep types.Entrypoint) string {
+	if ep.Protocol == "" {
+		return TCP
+	}
+	return ep.Protocol
+}
+
+// EntrypointNames returns the sorted entrypoint names of a catalog
+func EntrypointNames(catalog types.TraefikConfig) []string {
+	names := make([]string, 0, len(catalog.Entrypoints))
+	for name := range catalog.Entrypoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
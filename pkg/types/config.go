@@ -1,20 +1,61 @@
 package types
 
 type InfraConfig struct {
+	// CredentialNamespace selects a separate credential database so that
+	// contexts do not share server passwords
+	CredentialNamespace string `yaml:"credential_namespace,omitempty"`
+
 	Servers struct {
-		Gitlab  ServerConfig `yaml:"gitlab"`
-		Monitor ServerConfig `yaml:"monitor"`
-		Apps    ServerConfig `yaml:"apps"`
-	} `yaml:"servers"`
+		Manager ServerConfig `yaml:"manager,omitempty"`
+		Gitlab  ServerConfig `yaml:"gitlab,omitempty"`
+		Monitor ServerConfig `yaml:"monitor,omitempty"`
+		Apps    ServerConfig `yaml:"apps,omitempty"`
+	} `yaml:"servers,omitempty"`
+	Nodes  []NodeConfig `yaml:"nodes,omitempty"`
 	Domain struct {
-		Base     string `yaml:"base"`
-		Gitlab   string `yaml:"gitlab"`
-		Registry string `yaml:"registry"`
-		Monitor  string `yaml:"monitor"`
-		Apps     string `yaml:"apps"`
-	} `yaml:"domain"`
+		Base     string `yaml:"base,omitempty"`
+		Gitlab   string `yaml:"gitlab,omitempty"`
+		Registry string `yaml:"registry,omitempty"`
+		Monitor  string `yaml:"monitor,omitempty"`
+		Apps     string `yaml:"apps,omitempty"`
+		Email    string `yaml:"email,omitempty"`
+	} `yaml:"domain,omitempty"`
 	Auth struct {
-		Password string `yaml:"password"`
-		SSHKey   string `yaml:"ssh_key"`
-	} `yaml:"auth"`
+		Username string `yaml:"username,omitempty"`
+		Password string `yaml:"password,omitempty"`
+		SSHKey   string `yaml:"ssh_key,omitempty"`
+	} `yaml:"auth,omitempty"`
+	// Traefik holds the middleware catalog used by deploy service
+	Traefik TraefikConfig `yaml:"traefik,omitempty"`
+	// Roles declares custom server roles next to the built-in ones
+	Roles map[string]RoleDefinition `yaml:"roles,omitempty"`
+	// Defaults overrides the built-in defaults. It is kept as written so
+	// that saving the file does not expand it; see config.Defaults.
+	Defaults map[string]interface{} `yaml:"defaults,omitempty"`
+}
+
+// ServerList returns the configured servers that have an IP, manager first.
+// Servers without an explicit role take the role of the slot they are in.
+func (c *InfraConfig) ServerList() []ServerConfig {
+	slots := []struct {
+		role   ServerRole
+		server ServerConfig
+	}{
+		{ManagerServer, c.Servers.Manager},
+		{GitlabServer, c.Servers.Gitlab},
+		{MonitorServer, c.Servers.Monitor},
+		{AppsServer, c.Servers.Apps},
+	}
+
+	var servers []ServerConfig
+	for _, slot := range slots {
+		if slot.server.IP == "" {
+			continue
+		}
+		if slot.server.Role == "" {
+			slot.server.Role = slot.role
+		}
+		servers = append(servers, slot.server)
+	}
+	return servers
 }
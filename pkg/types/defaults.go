@@ -0,0 +1,60 @@
+package types
+
+// Defaults holds the CLI wide defaults from templates/config.yaml. Each
+// context may override any of them in the defaults section of its config.
+type Defaults struct {
+	Resources struct {
+		API        ResourceLimits `yaml:"api"`
+		Standalone ResourceLimits `yaml:"standalone"`
+	} `yaml:"resources"`
+	Service struct {
+		Replicas          int    `yaml:"replicas"`
+		UpdateParallelism int    `yaml:"update_parallelism"`
+		UpdateDelay       string `yaml:"update_delay"`
+		UpdateOrder       string `yaml:"update_order"`
+		UpdateMonitor     string `yaml:"update_monitor"`
+		RollbackDelay     string `yaml:"rollback_delay"`
+		FailureAction     string `yaml:"failure_action"`
+		MaxAttempts       int    `yaml:"max_attempts"`
+	} `yaml:"service"`
+	Monitoring struct {
+		PrometheusPort   int `yaml:"prometheus_port"`
+		GrafanaPort      int `yaml:"grafana_port"`
+		NodeExporterPort int `yaml:"node_exporter_port"`
+		CadvisorPort     int `yaml:"cadvisor_port"`
+	} `yaml:"monitoring"`
+	Backup struct {
+		RetentionDays int    `yaml:"retention_days"`
+		BackupDir     string `yaml:"backup_dir"`
+		Compression   bool   `yaml:"compression"`
+	} `yaml:"backup"`
+	DNS struct {
+		Nameservers []string `yaml:"nameservers"`
+	} `yaml:"dns"`
+	Security struct {
+		SSHPort         int   `yaml:"ssh_port"`
+		FirewallEnabled bool  `yaml:"firewall_enabled"`
+		Fail2banEnabled bool  `yaml:"fail2ban_enabled"`
+		AllowedPorts    []int `yaml:"allowed_ports"`
+	} `yaml:"security"`
+	Docker struct {
+		Version            string            `yaml:"version"`
+		SwarmAdvertiseAddr string            `yaml:"swarm_advertise_addr"`
+		LogDriver          string            `yaml:"log_driver"`
+		LogOpts            map[string]string `yaml:"log_opts"`
+	} `yaml:"docker"`
+}
+
+// ResourceLimits are the CPU and memory limits of a service
+type ResourceLimits struct {
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+// ResourcesFor returns the resource limits for an application type
+func (d Defaults) ResourcesFor(appType AppType) ResourceLimits {
+	if appType == StandaloneApp {
+		return d.Resources.Standalone
+	}
+	return d.Resources.API
+}
@@ -0,0 +1,55 @@
+package types
+
+// DesiredState is the swarm described by infra.yaml: the objects infra
+// apply creates and keeps in sync
+type DesiredState struct {
+	Networks map[string]NetworkSpec `yaml:"networks,omitempty"`
+	Secrets  map[string]SecretSpec  `yaml:"secrets,omitempty"`
+	// Nodes maps node hostnames to the labels they carry
+	Nodes    map[string]NodeSpec    `yaml:"nodes,omitempty"`
+	Services map[string]ServiceSpec `yaml:"services,omitempty"`
+	Stacks   map[string]StackSpec   `yaml:"stacks,omitempty"`
+}
+
+// NetworkSpec is an overlay network. Driver defaults to overlay.
+type NetworkSpec struct {
+	Driver     string `yaml:"driver,omitempty"`
+	Attachable bool   `yaml:"attachable,omitempty"`
+	Internal   bool   `yaml:"internal,omitempty"`
+}
+
+// SecretSpec is a secret read from a local File or a stored Credential given
+// as server/username
+type SecretSpec struct {
+	File       string `yaml:"file,omitempty"`
+	Credential string `yaml:"credential,omitempty"`
+}
+
+// NodeSpec holds the labels of a node
+type NodeSpec struct {
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// ServiceSpec is a standalone swarm service. Mode is replicated (the
+// default) or global, Replicas defaults to 1 for replicated services, Secrets
+// are secret names from the same file mounted under /run/secrets and Ports
+// are published as [published:]target[/protocol].
+type ServiceSpec struct {
+	Image     string            `yaml:"image"`
+	Mode      string            `yaml:"mode,omitempty"`
+	Replicas  int               `yaml:"replicas,omitempty"`
+	Env       []string          `yaml:"env,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	Placement []string          `yaml:"placement,omitempty"`
+	Networks  []string          `yaml:"networks,omitempty"`
+	Secrets   []string          `yaml:"secrets,omitempty"`
+	Ports     []string          `yaml:"ports,omitempty"`
+}
+
+// StackSpec is a stack deployed from a compose file, rendered with the
+// values files like deploy stack
+type StackSpec struct {
+	File   string `yaml:"file"`
+	Values string `yaml:"values,omitempty"`
+	Env    string `yaml:"env,omitempty"`
+}
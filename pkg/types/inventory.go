@@ -0,0 +1,153 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NodeConfig is a single host in the inventory
+type NodeConfig struct {
+	Name    string            `yaml:"name" json:"name"`
+	Address string            `yaml:"address" json:"address"`
+	Role    ServerRole        `yaml:"role" json:"role"`
+	User    string            `yaml:"user,omitempty" json:"user,omitempty"`
+	Labels  map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Groups  []string          `yaml:"groups,omitempty" json:"groups,omitempty"`
+	// Password is the SSH password of User. It is never exported.
+	Password string `yaml:"password,omitempty" json:"-"`
+	// Jump is the node name or host used as SSH jump host for this node
+	Jump string `yaml:"jump,omitempty" json:"jump,omitempty"`
+	// Credential names the stored credential for the node as user@server
+	Credential string `yaml:"credential,omitempty" json:"credential,omitempty"`
+}
+
+// InGroup reports whether the node belongs to group. Every node is an
+// implicit member of the group named after its role.
+func (n NodeConfig) InGroup(group string) bool {
+	if n.Role.String() == group {
+		return true
+	}
+	for _, g := range n.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Inventory returns every node in the configuration. Servers from the legacy
+// servers section are included under their role name unless a node with the
+// same address is already listed.
+func (c *InfraConfig) Inventory() []NodeConfig {
+	nodes := append([]NodeConfig(nil), c.Nodes...)
+
+	known := make(map[string]bool)
+	for _, node := range nodes {
+		known[node.Address] = true
+	}
+	for _, server := range c.ServerList() {
+		if known[server.IP] {
+			continue
+		}
+		nodes = append(nodes, NodeConfig{
+			Name:     server.Role.String(),
+			Address:  server.IP,
+			Role:     server.Role,
+			User:     server.Username,
+			Password: server.Password,
+			Labels:   server.Labels,
+		})
+	}
+	return nodes
+}
+
+// FindNode returns the node with the given name
+func (c *InfraConfig) FindNode(name string) (NodeConfig, bool) {
+	for _, node := range c.Inventory() {
+		if node.Name == name {
+			return node, true
+		}
+	}
+	return NodeConfig{}, false
+}
+
+// ResolveTarget resolves a node name or group to inventory nodes. It returns
+// nil when target matches neither, so callers can treat it as an address.
+func (c *InfraConfig) ResolveTarget(target string) []NodeConfig {
+	if node, ok := c.FindNode(target); ok {
+		return []NodeConfig{node}
+	}
+
+	var nodes []NodeConfig
+	for _, node := range c.Inventory() {
+		if node.InGroup(target) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// ResolveAddress resolves a node name or single-node group to an address.
+// Anything else is returned unchanged.
+func (c *InfraConfig) ResolveAddress(target string) (string, error) {
+	nodes := c.ResolveTarget(target)
+	switch len(nodes) {
+	case 0:
+		return target, nil
+	case 1:
+		return nodes[0].Address, nil
+	default:
+		return "", fmt.Errorf("%s matches %d nodes, a single node is required", target, len(nodes))
+	}
+}
+
+// Managers returns the manager nodes in inventory order
+func (c *InfraConfig) Managers() []NodeConfig {
+	var managers []NodeConfig
+	for _, node := range c.Inventory() {
+		if node.Role == ManagerServer {
+			managers = append(managers, node)
+		}
+	}
+	return managers
+}
+
+// AddNode adds a node, replacing any existing node with the same name
+func (c *InfraConfig) AddNode(node NodeConfig) {
+	for i, existing := range c.Nodes {
+		if existing.Name == node.Name {
+			c.Nodes[i] = node
+			return
+		}
+	}
+	c.Nodes = append(c.Nodes, node)
+}
+
+// RemoveNode removes the named node and reports whether it existed
+func (c *InfraConfig) RemoveNode(name string) bool {
+	for i, node := range c.Nodes {
+		if node.Name == name {
+			c.Nodes = append(c.Nodes[:i], c.Nodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Groups returns the sorted names of all explicit and role groups
+func (c *InfraConfig) Groups() []string {
+	seen := make(map[string]bool)
+	for _, node := range c.Inventory() {
+		seen[node.Role.String()] = true
+		for _, g := range node.Groups {
+			seen[g] = true
+		}
+	}
+
+	groups := make([]string, 0, len(seen))
+	for g := range seen {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
@@ -1,23 +1,97 @@
 package types
 
+import (
+	"fmt"
+	"sort"
+)
+
 type ServerRole string
 
 const (
 	ManagerServer ServerRole = "manager"
-	GitlabServer ServerRole = "gitlab"
+	GitlabServer  ServerRole = "gitlab"
 	MonitorServer ServerRole = "monitor"
 	AppsServer    ServerRole = "apps"
 )
 
 type ServerConfig struct {
-	IP       string
-	Username string
-	Password string
-	Role     ServerRole
-	Labels   map[string]string
+	IP       string            `yaml:"ip"`
+	Username string            `yaml:"username,omitempty"`
+	Password string            `yaml:"password,omitempty"`
+	Role     ServerRole        `yaml:"role"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
 }
 
-func ValidServerRoles() []ServerRole {
+// RoleDefinition describes how nodes of a role are labeled, prepared and
+// firewalled, and where services meant for the role are placed
+type RoleDefinition struct {
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Packages    []string          `yaml:"packages,omitempty"`
+	Directories []string          `yaml:"directories,omitempty"`
+	Setup       []string          `yaml:"setup,omitempty"`
+	Ports       []string          `yaml:"ports,omitempty"`
+	Placement   []string          `yaml:"placement,omitempty"`
+}
+
+var builtinRoles = map[ServerRole]RoleDefinition{
+	ManagerServer: {
+		Labels: map[string]string{
+			"node.role":       "manager",
+			"traefik.enabled": "true",
+		},
+	},
+	GitlabServer: {
+		Labels: map[string]string{
+			"service.type":   "gitlab",
+			"backup.enabled": "true",
+		},
+		Packages:    []string{"ca-certificates", "curl", "openssh-server"},
+		Directories: []string{"/etc/gitlab/config", "/var/log/gitlab", "/var/opt/gitlab"},
+	},
+	MonitorServer: {
+		Labels: map[string]string{
+			"service.type":    "monitor",
+			"metrics.enabled": "true",
+		},
+		Packages:    []string{"prometheus-node-exporter"},
+		Directories: []string{"/etc/prometheus", "/var/lib/prometheus"},
+	},
+	AppsServer: {
+		Labels: map[string]string{
+			"service.type":   "application",
+			"app.deployment": "enabled",
+		},
+		Packages:    []string{"docker-compose-plugin"},
+		Directories: []string{"/app/data", "/app/config"},
+	},
+}
+
+// customRoles holds the roles declared in the configuration file
+var customRoles = map[ServerRole]RoleDefinition{}
+
+// RegisterRoles replaces the custom roles with those from the configuration.
+// Built-in role names cannot be redefined.
+func RegisterRoles(roles map[string]RoleDefinition) error {
+	registered := make(map[ServerRole]RoleDefinition, len(roles))
+	for name, def := range roles {
+		role := ServerRole(name)
+		if _, ok := builtinRoles[role]; ok {
+			return fmt.Errorf("role %s is built in and cannot be redefined", name)
+		}
+		registered[role] = def
+	}
+	customRoles = registered
+	return nil
+}
+
+// IsBuiltinRole reports whether role is one of the built-in roles
+func IsBuiltinRole(role ServerRole) bool {
+	_, ok := builtinRoles[role]
+	return ok
+}
+
+// BuiltinRoles returns the built-in roles
+func BuiltinRoles() []ServerRole {
 	return []ServerRole{
 		ManagerServer,
 		GitlabServer,
@@ -26,6 +100,18 @@ func ValidServerRoles() []ServerRole {
 	}
 }
 
+func ValidServerRoles() []ServerRole {
+	roles := BuiltinRoles()
+
+	custom := make([]ServerRole, 0, len(customRoles))
+	for role := range customRoles {
+		custom = append(custom, role)
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i] < custom[j] })
+
+	return append(roles, custom...)
+}
+
 func (r ServerRole) String() string {
 	return string(r)
 }
@@ -39,25 +125,32 @@ func IsValidServerRole(role string) bool {
 	return false
 }
 
+// GetRoleDefinition returns the definition of a built-in or custom role.
+// Roles without explicit placement are placed on nodes labeled with the role.
+func GetRoleDefinition(role ServerRole) (RoleDefinition, bool) {
+	def, ok := builtinRoles[role]
+	if !ok {
+		def, ok = customRoles[role]
+	}
+	if !ok {
+		return RoleDefinition{}, false
+	}
+
+	if len(def.Placement) == 0 {
+		def.Placement = []string{fmt.Sprintf("node.labels.role == %s", role)}
+	}
+	return def, true
+}
+
 // GetServerLabels returns the appropriate Docker labels for each server role
 func GetServerLabels(role ServerRole) map[string]string {
 	labels := map[string]string{
 		"role": role.String(),
 	}
 
-	switch role {
-	case GitlabServer:
-		labels["service.type"] = "gitlab"
-		labels["backup.enabled"] = "true"
-	case MonitorServer:
-		labels["service.type"] = "monitor"
-		labels["metrics.enabled"] = "true"
-	case AppsServer:
-		labels["service.type"] = "application"
-		labels["app.deployment"] = "enabled"
-	case ManagerServer:
-		labels["node.role"] = "manager"
-		labels["traefik.enabled"] = "true"
+	def, _ := GetRoleDefinition(role)
+	for key, value := range def.Labels {
+		labels[key] = value
 	}
 
 	return labels
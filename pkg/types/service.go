@@ -13,20 +13,28 @@ const (
 	Java   Language = "java"
 )
 
+// ServiceConfig describes a service; Environment holds KEY=value entries
 type ServiceConfig struct {
-	ServiceName string
-	AppType     AppType
-	Language    Language
-	ImageName   string
-	Version     string
-	Replicas    int
-	CPU         string
-	Memory      string
-	Port        int
-	Environment []string
-	Domain      string
-	Subdomain   string
-	UseTraefik  bool
+	ServiceName string   `yaml:"service_name"`
+	AppType     AppType  `yaml:"app_type"`
+	Language    Language `yaml:"language,omitempty"`
+	ImageName   string   `yaml:"image_name"`
+	Version     string   `yaml:"version"`
+	Replicas    int      `yaml:"replicas"`
+	CPU         string   `yaml:"cpu,omitempty"`
+	Memory      string   `yaml:"memory,omitempty"`
+	Port        int      `yaml:"port,omitempty"`
+	Healthcheck []string `yaml:"healthcheck,omitempty"`
+	Command     []string `yaml:"command,omitempty"`
+	Environment []string `yaml:"environment,omitempty"`
+	Domain      string   `yaml:"domain,omitempty"`
+	Subdomain   string   `yaml:"subdomain,omitempty"`
+	UseTraefik  bool     `yaml:"use_traefik,omitempty"`
+	// Protocol is http (the default), tcp or udp. TCP and UDP routes use
+	// Entrypoint, and TCP routes terminate or pass through TLS.
+	Protocol   string `yaml:"protocol,omitempty"`
+	Entrypoint string `yaml:"entrypoint,omitempty"`
+	TLS        string `yaml:"tls,omitempty"`
 }
 
 // Service represents a Docker service
@@ -59,18 +67,53 @@ type Secret struct {
 	Encoding string
 }
 
-// DeploymentConfig represents the configuration for a service deployment
+// DeploymentConfig is the data the deployment templates are rendered with:
+// the service itself plus the swarm settings it is deployed with
 type DeploymentConfig struct {
-	ServiceName string
-	ImageName   string
-	Port        int
-	Replicas    int
-	Domain      string
-	Subdomain   string
-	UseTraefik  bool
-	Labels      map[string]string
-	Environment map[string]string
-	Email       string
+	ServiceConfig `yaml:",inline"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Email         string            `yaml:"email,omitempty"`
+	LogDriver     string            `yaml:"log_driver,omitempty"`
+	LogOptions    map[string]string `yaml:"log_options,omitempty"`
+	Placement     []string          `yaml:"placement,omitempty"`
+	// UpdateConfig and RollbackConfig control how swarm rolls out and rolls
+	// back new versions of the service
+	UpdateConfig   *UpdateConfig `yaml:"update_config,omitempty"`
+	RollbackConfig *UpdateConfig `yaml:"rollback_config,omitempty"`
+	// MaxAttempts limits restarts of failing tasks, zero restarts forever
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+	// Configs and Secrets are files mounted into the service
+	Configs []FileMount `yaml:"configs,omitempty"`
+	Secrets []FileMount `yaml:"secrets,omitempty"`
+	// Middlewares are Traefik middleware or chain names from the catalog
+	Middlewares []string `yaml:"middlewares,omitempty"`
+	// Entrypoints are the extra entrypoints of the Traefik stack
+	Entrypoints map[string]Entrypoint `yaml:"-"`
+	// Values holds free-form data for user templates, such as sidecars or
+	// extra volumes
+	Values map[string]interface{} `yaml:"values,omitempty"`
+}
+
+// UpdateConfig is the update_config or rollback_config of a service
+type UpdateConfig struct {
+	Parallelism   int    `yaml:"parallelism"`
+	Delay         string `yaml:"delay,omitempty"`
+	FailureAction string `yaml:"failure_action,omitempty"`
+	Monitor       string `yaml:"monitor,omitempty"`
+	Order         string `yaml:"order,omitempty"`
+}
+
+// FileMount is a swarm config or secret mounted at Target. The content comes
+// from a local File or, for secrets, a stored Credential given as
+// server/username. Object is the content-versioned swarm object name and is
+// set when the mount is published.
+type FileMount struct {
+	Name       string `yaml:"name"`
+	File       string `yaml:"file,omitempty"`
+	Credential string `yaml:"credential,omitempty"`
+	Target     string `yaml:"target"`
+	Mode       string `yaml:"mode,omitempty"`
+	Object     string `yaml:"-"`
 }
 
 func ValidAppTypes() []AppType {
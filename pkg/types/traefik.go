@@ -0,0 +1,46 @@
+package types
+
+// TraefikConfig holds the middleware catalog shared by deployed services
+// and the extra entrypoints of the Traefik stack. Services refer to
+// middlewares, chains and entrypoints by name.
+type TraefikConfig struct {
+	Middlewares map[string]Middleware `yaml:"middlewares,omitempty"`
+	// Chains are ordered lists of middleware or chain names
+	Chains map[string][]string `yaml:"chains,omitempty"`
+	// Entrypoints are TCP and UDP entrypoints besides web and websecure
+	Entrypoints map[string]Entrypoint `yaml:"entrypoints,omitempty"`
+}
+
+// Entrypoint is a Traefik entrypoint listening on Port. Protocol is tcp
+// (the default) or udp.
+type Entrypoint struct {
+	Port     int    `yaml:"port"`
+	Protocol string `yaml:"protocol,omitempty"`
+}
+
+// Middleware is a Traefik middleware. Exactly one of its fields is set.
+type Middleware struct {
+	// BasicAuth lists server/username references to the credential store
+	BasicAuth       []string       `yaml:"basic_auth,omitempty"`
+	RateLimit       *RateLimit     `yaml:"rate_limit,omitempty"`
+	IPAllowList     []string       `yaml:"ip_allowlist,omitempty"`
+	SecurityHeaders bool           `yaml:"security_headers,omitempty"`
+	Compress        bool           `yaml:"compress,omitempty"`
+	Retry           int            `yaml:"retry,omitempty"`
+	StripPrefix     []string       `yaml:"strip_prefix,omitempty"`
+	RedirectScheme  string         `yaml:"redirect_scheme,omitempty"`
+	RedirectRegex   *RedirectRegex `yaml:"redirect_regex,omitempty"`
+}
+
+// RateLimit allows Average requests per second with bursts of Burst
+type RateLimit struct {
+	Average int `yaml:"average"`
+	Burst   int `yaml:"burst,omitempty"`
+}
+
+// RedirectRegex redirects requests matching Regex to Replacement
+type RedirectRegex struct {
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+	Permanent   bool   `yaml:"permanent,omitempty"`
+}
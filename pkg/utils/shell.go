@@ -0,0 +1,8 @@
+package utils
+
+import "strings"
+
+// ShellQuote quotes value as a single word for a POSIX shell
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
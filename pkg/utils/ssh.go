@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"os/exec"
 )
@@ -17,3 +18,38 @@ func ExecuteRemoteCommand(ip, user, pass, command string) (string, error) {
 
 	return string(output), nil
 }
+
+// ExecuteKeyCommand executes a command on a remote server via SSH using only
+// public key authentication. Password prompts are disabled so that a failing
+// key login returns an error instead of hanging.
+func ExecuteKeyCommand(ip, user, identity, command string) (string, error) {
+	args := []string{"-o", "StrictHostKeyChecking=no", "-o", "BatchMode=yes",
+		"-o", "PasswordAuthentication=no"}
+	if identity != "" {
+		args = append(args, "-i", identity, "-o", "IdentitiesOnly=yes")
+	}
+	args = append(args, fmt.Sprintf("%s@%s", user, ip), command)
+
+	output, err := exec.Command("ssh", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return string(output), nil
+}
+
+// ExecuteRemoteCommandInput executes a command on a remote server via SSH and
+// feeds input to its stdin. Use it for secret material that must not appear
+// in the remote process list.
+func ExecuteRemoteCommandInput(ip, user, pass, command string, input []byte) (string, error) {
+	sshCmd := exec.Command("sshpass", "-p", pass, "ssh", "-o", "StrictHostKeyChecking=no",
+		fmt.Sprintf("%s@%s", user, ip), command)
+	sshCmd.Stdin = bytes.NewReader(input)
+
+	output, err := sshCmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("command failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return string(output), nil
+}
@@ -0,0 +1,83 @@
+// Package values loads Helm-style layered values files: a base file and an
+// optional per-environment overlay deep-merged over it.
+package values
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the base values file used when only an environment is given
+const DefaultFile = "values.yaml"
+
+// Files returns the values files for base and env. The overlay for env sits
+// next to base, so values.yaml with env staging adds values.staging.yaml.
+func Files(base, env string) []string {
+	if base == "" && env == "" {
+		return nil
+	}
+	if base == "" {
+		base = DefaultFile
+	}
+	files := []string{base}
+	if env != "" {
+		ext := filepath.Ext(base)
+		files = append(files, fmt.Sprintf("%s.%s%s", strings.TrimSuffix(base, ext), env, ext))
+	}
+	return files
+}
+
+// Load reads files in order and deep-merges each over the previous ones
+func Load(files ...string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values: %w", err)
+		}
+
+		layer := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &layer); err != nil {
+			return nil, fmt.Errorf("failed to parse values %s: %w", file, err)
+		}
+		merged = Merge(merged, layer)
+	}
+	return merged, nil
+}
+
+// Merge deep-merges src over dst and returns dst. Nested maps are merged key
+// by key; lists and scalars in src replace those in dst, and a null in src
+// removes the key.
+func Merge(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[key] = Merge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// Decode stores merged values in out through its YAML tags, keeping fields
+// of out that the values do not set
+func Decode(values map[string]interface{}, out interface{}) error {
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode values: %w", err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode values: %w", err)
+	}
+	return nil
+}
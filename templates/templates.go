@@ -0,0 +1,10 @@
+// Package templates embeds the default files shipped in the templates
+// directory.
+package templates
+
+import _ "embed"
+
+// DefaultConfig is the content of config.yaml, the built-in CLI defaults
+//
+//go:embed config.yaml
+var DefaultConfig []byte